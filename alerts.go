@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/olekukonko/tablewriter"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const priceAlertsLimit = 20
+
+func parsePriceAlert(arguments string) (*PriceAlert, error) {
+	arguments = strings.NewReplacer(">", " > ", "<", " < ").Replace(strings.ToUpper(arguments))
+	args := strings.Fields(arguments)
+
+	if len(args) != 3 && !(len(args) == 4 && args[3] == "REARM") {
+		return nil, errors.New("usage: /alert ETH > 2000 [rearm]")
+	}
+
+	if args[1] != ">" && args[1] != "<" {
+		return nil, errors.New("direction must be > or <")
+	}
+
+	price, err := strconv.ParseFloat(strings.Replace(args[2], ",", ".", 1), 64)
+	if err != nil || price <= 0 {
+		return nil, errors.New("invalid price " + args[2])
+	}
+
+	alert := &PriceAlert{
+		Code:      args[0],
+		Direction: args[1],
+		Price:     price,
+		IsActive:  PriceAlert_IS_ACTIVE_TRUE,
+		CreatedAt: time.Now(),
+	}
+
+	if len(args) == 4 {
+		alert.IsRearm = 1
+	}
+
+	return alert, nil
+}
+
+func (a *PriceAlert) isCrossed(price float64) bool {
+	if a.Direction == ">" {
+		return price >= a.Price
+	}
+	return price <= a.Price
+}
+
+// check fires an armed alert that the price crossed and rearms a fired rearm alert the price went back from,
+// it reports whether the alert changed.
+func (a *PriceAlert) check(price float64, now time.Time) bool {
+	if a.IsActive == PriceAlert_IS_ACTIVE_FALSE {
+		if a.IsRearm != 1 || a.isCrossed(price) {
+			return false
+		}
+		a.IsActive = PriceAlert_IS_ACTIVE_TRUE
+		return true
+	}
+
+	if !a.isCrossed(price) {
+		return false
+	}
+
+	a.IsActive = PriceAlert_IS_ACTIVE_FALSE
+	a.TriggeredPrice = price
+	a.TriggeredAt = now
+
+	return true
+}
+
+func (a *PriceAlert) getQuote() string {
+	if a.Quote == "" {
+		return defaultQuote()
+	}
+	return a.Quote
+}
+
+func (a *PriceAlert) String() string {
+	return pairName(a.Code, a.getQuote()) + " " + a.Direction + " " + PriceToStr(a.Price)
+}
+
+func (a *PriceAlert) update() (err error) {
+	a.UpdatedAt = time.Now()
+	_, err = dbConnect.Model(a).
+		Set("is_active = ?is_active").
+		Set("triggered_price = ?triggered_price").
+		Set("triggered_at = ?triggered_at").
+		Set("updated_at = ?updated_at").
+		Where("id = ?id").
+		Update()
+
+	return err
+}
+
+func (s *Subscriber) getPriceAlerts() ([]PriceAlert, error) {
+	var alerts []PriceAlert
+	err := dbConnect.Model(&alerts).
+		Where("subscriber_id = ?", s.Id).
+		Order("id ASC").
+		Select()
+
+	return alerts, err
+}
+
+func (s *Subscriber) addPriceAlert(alert *PriceAlert) (err error) {
+	alert.SubscriberId = s.Id
+	_, err = dbConnect.Model(alert).Insert()
+
+	return err
+}
+
+func (s *Subscriber) deletePriceAlerts(ids []int64) (int, error) {
+	query := dbConnect.Model((*PriceAlert)(nil)).
+		Where("subscriber_id = ?", s.Id)
+
+	if len(ids) > 0 {
+		query.Where("id IN (?)", pg.In(ids))
+	}
+
+	res, err := query.Delete()
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
+
+func checkPriceAlerts(ctx context.Context) {
+	var alerts []PriceAlert
+	err := dbConnect.ModelContext(ctx, &alerts).
+		Where("is_active = ? OR is_rearm = 1", PriceAlert_IS_ACTIVE_TRUE).
+		Select()
+
+	if err != nil {
+		log.Warnf("can't get price alerts: %v", err)
+		return
+	}
+
+	if len(alerts) == 0 {
+		return
+	}
+
+	prices, err := getAlertPrices(marketData.WithContext(ctx), alerts)
+	if err != nil {
+		log.Warnf("can't get latest prices: %v", err)
+		return
+	}
+
+	fired := make(map[int64][]string)
+
+	for i := range alerts {
+		if ctx.Err() != nil {
+			break
+		}
+
+		alert := &alerts[i]
+
+		price, ok := prices[alert.getQuote()][alert.Code]
+		if !ok {
+			continue
+		}
+
+		if !alert.check(price.Close, time.Now()) {
+			continue
+		}
+
+		if err := alert.update(); err != nil {
+			log.Warnf("can't update price alert: %v", err)
+			continue
+		}
+
+		// rearmed
+		if alert.IsActive == PriceAlert_IS_ACTIVE_TRUE {
+			continue
+		}
+
+		fired[alert.SubscriberId] = append(fired[alert.SubscriberId],
+			fmt.Sprintf("%s crossed %s: %s", pairName(alert.Code, alert.getQuote()), alert.Direction+" "+PriceToStr(alert.Price), PriceToStr(price.Close)))
+	}
+
+	if len(fired) == 0 {
+		return
+	}
+
+	// the fired alerts are already deactivated, so they are queued even when the job is cancelled
+	sendPriceAlerts(fired)
+}
+
+// getAlertPrices reads the latest prices of the alert coins by quote.
+func getAlertPrices(repository MarketDataRepository, alerts []PriceAlert) (map[string]map[string]CoinPrice, error) {
+	codes := make(map[string][]string)
+	for _, alert := range alerts {
+		quote := alert.getQuote()
+		if !containsString(codes[quote], alert.Code) {
+			codes[quote] = append(codes[quote], alert.Code)
+		}
+	}
+
+	prices := make(map[string]map[string]CoinPrice, len(codes))
+	for quote := range codes {
+		quotePrices, err := repository.GetLatestPrices(quote, codes[quote])
+		if err != nil {
+			return nil, err
+		}
+		prices[quote] = quotePrices
+	}
+
+	return prices, nil
+}
+
+func sendPriceAlerts(fired map[int64][]string) {
+	ids := make([]int64, 0, len(fired))
+	for id := range fired {
+		ids = append(ids, id)
+	}
+
+	var subscribers []Subscriber
+	err := dbConnect.Model(&subscribers).
+		Where("is_enabled = ?", 1).
+		Where("id IN (?)", pg.In(ids)).
+		Select()
+
+	if err != nil {
+		log.Warnf("can't get subscribers: %v", err)
+		return
+	}
+
+	for i := range subscribers {
+		subscriber := &subscribers[i]
+		text := "Price alert\n" + strings.Join(fired[subscriber.Id], "\n")
+
+		notify(subscriber, NotificationKindPriceAlert, text, nil, nil)
+	}
+}
+
+func handleAlertCommand(subscriber *Subscriber, arguments string) string {
+	alert, err := parsePriceAlert(arguments)
+	if err != nil {
+		return err.Error()
+	}
+
+	alerts, err := subscriber.getPriceAlerts()
+	if err != nil {
+		log.Warnf("can't get price alerts: %v", err)
+		return "Возникла ошибка №435/6"
+	}
+
+	if len(alerts) >= priceAlertsLimit {
+		return "Too many alerts, delete some with /alerts delete <id>"
+	}
+
+	alert.Quote = subscriber.getQuote()
+
+	exists, err := marketData.CoinExists(alert.Code, alert.Quote)
+	if err != nil {
+		log.Warnf("can't check coin %s: %v", alert.Code, err)
+		return "Возникла ошибка №435/6"
+	}
+
+	if !exists {
+		return pairName(alert.Code, alert.Quote) + ": pair not found"
+	}
+
+	if err := subscriber.addPriceAlert(alert); err != nil {
+		log.Warnf("can't add price alert: %v", err)
+		return "Возникла ошибка №435/6"
+	}
+
+	return "Alert #" + strconv.FormatInt(alert.Id, 10) + " " + alert.String() + " created"
+}
+
+func handleAlertsCommand(subscriber *Subscriber, arguments string) string {
+	args := strings.Fields(strings.ToLower(arguments))
+
+	if len(args) > 0 {
+		if args[0] != "delete" || len(args) == 1 {
+			return "Usage: /alerts, /alerts delete <id> or /alerts delete all"
+		}
+
+		var ids []int64
+		if args[1] != "all" {
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+				if err != nil {
+					return "Invalid alert id " + arg
+				}
+				ids = append(ids, id)
+			}
+		}
+
+		count, err := subscriber.deletePriceAlerts(ids)
+		if err != nil {
+			log.Warnf("can't delete price alerts: %v", err)
+			return "Возникла ошибка №435/6"
+		}
+
+		return "Deleted alerts: " + IntToStr(count)
+	}
+
+	alerts, err := subscriber.getPriceAlerts()
+	if err != nil {
+		log.Warnf("can't get price alerts: %v", err)
+		return "Возникла ошибка №435/6"
+	}
+
+	if len(alerts) == 0 {
+		return "No alerts, create one with /alert ETH > 2000"
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Id", "Alert", "Status"})
+
+	for _, alert := range alerts {
+		status := "armed"
+		if alert.IsActive == PriceAlert_IS_ACTIVE_FALSE {
+			status = "fired at " + PriceToStr(alert.TriggeredPrice)
+		}
+		if alert.IsRearm == 1 {
+			status += ", rearm"
+		}
+
+		table.Append([]string{strconv.FormatInt(alert.Id, 10), alert.String(), status})
+	}
+
+	table.Render()
+
+	return tableString.String()
+}
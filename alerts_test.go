@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePriceAlert(t *testing.T) {
+	tests := []struct {
+		arguments string
+		code      string
+		direction string
+		price     float64
+		rearm     int8
+	}{
+		{"ETH > 2000", "ETH", ">", 2000, 0},
+		{"eth>2000", "ETH", ">", 2000, 0},
+		{"BTC < 40000,5", "BTC", "<", 40000.5, 0},
+		{"btc <0.5 rearm", "BTC", "<", 0.5, 1},
+		{"SOL > 99.9 REARM", "SOL", ">", 99.9, 1},
+	}
+
+	for _, test := range tests {
+		alert, err := parsePriceAlert(test.arguments)
+		if err != nil {
+			t.Errorf("%q: %v", test.arguments, err)
+			continue
+		}
+		if alert.Code != test.code || alert.Direction != test.direction || alert.Price != test.price ||
+			alert.IsRearm != test.rearm || alert.IsActive != PriceAlert_IS_ACTIVE_TRUE {
+			t.Errorf("%q: got %+v", test.arguments, alert)
+		}
+	}
+
+	for _, arguments := range []string{
+		"",
+		"ETH",
+		"ETH 2000",
+		"ETH = 2000",
+		"ETH > abc",
+		"ETH > 0",
+		"ETH > 1,000,000",
+		"ETH > 2000 now",
+		"ETH > 2000 rearm twice",
+		"ETH > < 2000",
+	} {
+		if alert, err := parsePriceAlert(arguments); err == nil {
+			t.Errorf("%q: got %+v, want an error", arguments, alert)
+		}
+	}
+}
+
+// TestCheckPriceAlerts checks the alerts at the fixture prices, BTC/BUSD 43082.28 and ETH/BUSD 3209.75.
+func TestCheckPriceAlerts(t *testing.T) {
+	setConfig(Config{Quotes: []string{"BUSD"}})
+	testMarketData(t)
+
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	fired, armed := int8(PriceAlert_IS_ACTIVE_FALSE), int8(PriceAlert_IS_ACTIVE_TRUE)
+
+	tests := []struct {
+		name    string
+		alert   PriceAlert
+		changed bool
+		active  int8
+	}{
+		{"above crossed", PriceAlert{Code: "BTC", Direction: ">", Price: 40000, IsActive: armed}, true, fired},
+		{"above at the price", PriceAlert{Code: "BTC", Direction: ">", Price: 43082.28, IsActive: armed}, true, fired},
+		{"above not crossed", PriceAlert{Code: "BTC", Direction: ">", Price: 50000, IsActive: armed}, false, armed},
+		{"below crossed", PriceAlert{Code: "ETH", Quote: "BUSD", Direction: "<", Price: 3500, IsActive: armed}, true, fired},
+		{"below not crossed", PriceAlert{Code: "ETH", Direction: "<", Price: 3000, IsActive: armed}, false, armed},
+		{"fired stays while crossed", PriceAlert{Code: "BTC", Direction: ">", Price: 40000, IsActive: fired, IsRearm: 1}, false, fired},
+		{"rearm after the price went back", PriceAlert{Code: "BTC", Direction: ">", Price: 50000, IsActive: fired, IsRearm: 1}, true, armed},
+		{"fired without rearm", PriceAlert{Code: "BTC", Direction: ">", Price: 50000, IsActive: fired}, false, fired},
+	}
+
+	var alerts []PriceAlert
+	for _, test := range tests {
+		alerts = append(alerts, test.alert)
+	}
+	alerts = append(alerts, PriceAlert{Code: "XRP", Direction: ">", Price: 1, IsActive: armed})
+
+	prices, err := getAlertPrices(marketData, alerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := prices["BUSD"]["XRP"]; ok || len(prices["BUSD"]) != 2 {
+		t.Fatalf("got prices %+v, want BTC and ETH", prices)
+	}
+
+	for i, test := range tests {
+		alert := alerts[i]
+		price := prices[alert.getQuote()][alert.Code]
+
+		if changed := alert.check(price.Close, now); changed != test.changed || alert.IsActive != test.active {
+			t.Errorf("%s: got changed %v, active %d, want %v, %d", test.name, changed, alert.IsActive, test.changed, test.active)
+		}
+		if test.changed && test.active == fired && (alert.TriggeredPrice != price.Close || !alert.TriggeredAt.Equal(now)) {
+			t.Errorf("%s: got triggered %v at %s", test.name, alert.TriggeredPrice, alert.TriggeredAt)
+		}
+	}
+}
+
+func TestPriceAlertRearm(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	alert := &PriceAlert{Code: "ETH", Direction: ">", Price: 3000, IsActive: PriceAlert_IS_ACTIVE_TRUE, IsRearm: 1}
+
+	// fires, stays fired above the price, rearms below it and fires again
+	steps := []struct {
+		price   float64
+		changed bool
+		active  int8
+	}{
+		{2900, false, PriceAlert_IS_ACTIVE_TRUE},
+		{3100, true, PriceAlert_IS_ACTIVE_FALSE},
+		{3200, false, PriceAlert_IS_ACTIVE_FALSE},
+		{2990, true, PriceAlert_IS_ACTIVE_TRUE},
+		{3000, true, PriceAlert_IS_ACTIVE_FALSE},
+	}
+
+	for i, step := range steps {
+		if changed := alert.check(step.price, now); changed != step.changed || alert.IsActive != step.active {
+			t.Errorf("step %d at %v: got changed %v, active %d, want %v, %d", i, step.price, changed, alert.IsActive, step.changed, step.active)
+		}
+	}
+	if alert.TriggeredPrice != 3000 {
+		t.Errorf("got triggered price %v, want the last crossing", alert.TriggeredPrice)
+	}
+}
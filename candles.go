@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+	"github.com/wcharczuk/go-chart/util"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ChartTypeLine    = "line"
+	ChartTypeCandles = "candles"
+)
+
+var (
+	candleUpColor   = drawing.ColorFromHex("26a69a")
+	candleDownColor = drawing.ColorFromHex("ef5350")
+)
+
+// CandlestickSeries draws OHLC candles on the primary axis.
+type CandlestickSeries struct {
+	Name   string
+	Style  chart.Style
+	Klines []Kline
+}
+
+func (cs CandlestickSeries) GetName() string {
+	return cs.Name
+}
+
+func (cs CandlestickSeries) GetStyle() chart.Style {
+	return cs.Style
+}
+
+func (cs CandlestickSeries) GetYAxis() chart.YAxisType {
+	return chart.YAxisPrimary
+}
+
+func (cs CandlestickSeries) Len() int {
+	return len(cs.Klines)
+}
+
+func (cs CandlestickSeries) GetBoundedValues(index int) (x, y1, y2 float64) {
+	kline := cs.Klines[index]
+	return util.Time.ToFloat64(kline.OpenTime), kline.Low, kline.High
+}
+
+func (cs CandlestickSeries) GetValueFormatters() (x, y chart.ValueFormatter) {
+	return chart.TimeValueFormatter, chart.FloatValueFormatter
+}
+
+func (cs CandlestickSeries) Validate() error {
+	if len(cs.Klines) == 0 {
+		return errors.New("candlestick series must have klines")
+	}
+	return nil
+}
+
+func (cs CandlestickSeries) Render(r chart.Renderer, canvasBox chart.Box, xrange, yrange chart.Range, defaults chart.Style) {
+	width := candleWidth(canvasBox, len(cs.Klines))
+
+	for _, kline := range cs.Klines {
+		color := candleUpColor
+		if kline.Close < kline.Open {
+			color = candleDownColor
+		}
+
+		x := canvasBox.Left + xrange.Translate(util.Time.ToFloat64(kline.OpenTime))
+		high := canvasBox.Bottom - yrange.Translate(kline.High)
+		low := canvasBox.Bottom - yrange.Translate(kline.Low)
+		open := canvasBox.Bottom - yrange.Translate(kline.Open)
+		close := canvasBox.Bottom - yrange.Translate(kline.Close)
+
+		r.SetStrokeColor(color)
+		r.SetStrokeWidth(1)
+		r.MoveTo(x, high)
+		r.LineTo(x, low)
+		r.Stroke()
+
+		top, bottom := open, close
+		if top > bottom {
+			top, bottom = bottom, top
+		}
+		if bottom == top {
+			bottom++
+		}
+
+		r.SetFillColor(color)
+		fillRect(r, x-width/2, top, x+width/2, bottom)
+	}
+}
+
+// VolumeBarSeries draws quote volume bars on the secondary axis, scaled into the lower part of the canvas.
+type VolumeBarSeries struct {
+	Name   string
+	Style  chart.Style
+	Klines []Kline
+}
+
+func (vs VolumeBarSeries) GetName() string {
+	return vs.Name
+}
+
+func (vs VolumeBarSeries) GetStyle() chart.Style {
+	return vs.Style
+}
+
+func (vs VolumeBarSeries) GetYAxis() chart.YAxisType {
+	return chart.YAxisSecondary
+}
+
+func (vs VolumeBarSeries) Len() int {
+	return len(vs.Klines)
+}
+
+func (vs VolumeBarSeries) GetValues(index int) (x, y float64) {
+	kline := vs.Klines[index]
+	return util.Time.ToFloat64(kline.OpenTime), kline.QuoteAssetVolume
+}
+
+func (vs VolumeBarSeries) Validate() error {
+	if len(vs.Klines) == 0 {
+		return errors.New("volume series must have klines")
+	}
+	return nil
+}
+
+func (vs VolumeBarSeries) Render(r chart.Renderer, canvasBox chart.Box, xrange, yrange chart.Range, defaults chart.Style) {
+	width := candleWidth(canvasBox, len(vs.Klines))
+
+	for _, kline := range vs.Klines {
+		color := candleUpColor.WithAlpha(120)
+		if kline.Close < kline.Open {
+			color = candleDownColor.WithAlpha(120)
+		}
+
+		x := canvasBox.Left + xrange.Translate(util.Time.ToFloat64(kline.OpenTime))
+		top := canvasBox.Bottom - yrange.Translate(kline.QuoteAssetVolume)
+
+		r.SetFillColor(color)
+		r.SetStrokeColor(color)
+		fillRect(r, x-width/2, top, x+width/2, canvasBox.Bottom)
+	}
+}
+
+func candleWidth(canvasBox chart.Box, count int) int {
+	if count == 0 {
+		return 1
+	}
+
+	width := int(float64(canvasBox.Width()) / float64(count) * 0.6)
+	if width < 1 {
+		return 1
+	}
+
+	return width
+}
+
+func fillRect(r chart.Renderer, left, top, right, bottom int) {
+	if right <= left {
+		right = left + 1
+	}
+
+	r.MoveTo(left, top)
+	r.LineTo(right, top)
+	r.LineTo(right, bottom)
+	r.LineTo(left, bottom)
+	r.Close()
+	r.Fill()
+}
+
+func renderCandlestickGraph(coin string, quote string, interval string) ([]byte, error) {
+	if coin == "" {
+		coin = "BTC"
+	}
+
+	klines := getKlinesForCoinGraph(coin, quote, interval)
+
+	if len(klines) == 0 {
+		return nil, nil
+	}
+
+	min, max := math.MaxFloat64, -math.MaxFloat64
+	maxVolume := 0.0
+	for _, kline := range klines {
+		min = math.Min(min, kline.Low)
+		max = math.Max(max, kline.High)
+		maxVolume = math.Max(maxVolume, kline.QuoteAssetVolume)
+	}
+	min, max = padRange(min, max)
+	_, maxVolume = padRange(0, maxVolume)
+
+	// leave the lower quarter of the canvas to the volume subpanel
+	padding := (max - min) / 3
+
+	graph := chart.Chart{
+		Width:  1024,
+		Height: 512,
+		XAxis: chart.XAxis{
+			Style:          chart.Style{Show: true},
+			TickPosition:   chart.TickPositionBetweenTicks,
+			ValueFormatter: chart.TimeValueFormatterWithFormat("01-02 15:04"),
+		},
+		YAxis: chart.YAxis{
+			Style: chart.Style{Show: true},
+			Range: &chart.ContinuousRange{
+				Max: max,
+				Min: min - padding,
+			},
+		},
+		YAxisSecondary: chart.YAxis{
+			Style: chart.Style{Show: false},
+			Range: &chart.ContinuousRange{
+				Max: maxVolume * 4,
+				Min: 0,
+			},
+		},
+		Series: []chart.Series{
+			VolumeBarSeries{
+				Name:   coin + " - Volume",
+				Style:  chart.Style{Show: true, FillColor: candleUpColor.WithAlpha(120)},
+				Klines: klines,
+			},
+			CandlestickSeries{
+				Name:   pairName(coin, quote) + " " + chartIntervalName(interval),
+				Style:  chart.Style{Show: true, StrokeColor: candleUpColor},
+				Klines: klines,
+			},
+		},
+	}
+
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph),
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+type ChartInterval struct {
+	Name string
+	// Range is the length of the window
+	Range time.Duration
+	// Bucket is the aggregated candle length, 0 keeps the raw klines
+	Bucket time.Duration
+}
+
+var chartIntervals = []ChartInterval{
+	{Name: "10m", Range: 10 * time.Minute},
+	{Name: "15m", Range: 15 * time.Minute},
+	{Name: "1h", Range: time.Hour},
+	{Name: "4h", Range: 4 * time.Hour},
+	{Name: "12h", Range: 12 * time.Hour, Bucket: 5 * time.Minute},
+	{Name: "1d", Range: 24 * time.Hour, Bucket: 15 * time.Minute},
+	{Name: "7d", Range: 7 * 24 * time.Hour, Bucket: time.Hour},
+	{Name: "30d", Range: 30 * 24 * time.Hour, Bucket: 4 * time.Hour},
+}
+
+// intervalPattern matches anything shaped like an interval, so an unsupported one isn't taken for a coin code.
+var intervalPattern = regexp.MustCompile(`(?i)^\d+(m|min|h|d|w)$`)
+
+func getChartInterval(value string) (ChartInterval, bool) {
+	value = strings.ToLower(value)
+
+	switch value {
+	case "":
+		value = "4h"
+	case "24h":
+		value = "1d"
+	}
+
+	for _, interval := range chartIntervals {
+		if interval.Name == value {
+			return interval, true
+		}
+	}
+
+	return ChartInterval{}, false
+}
+
+func chartIntervalName(value string) string {
+	interval, ok := getChartInterval(value)
+	if !ok {
+		return value
+	}
+	return interval.Name
+}
+
+func chartIntervalNames() string {
+	names := make([]string, 0, len(chartIntervals))
+	for _, interval := range chartIntervals {
+		names = append(names, interval.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func handleChartCommand(ctx context.Context, bot *tgbotapi.BotAPI, subscriber *Subscriber, arguments string) string {
+	args := strings.Fields(arguments)
+
+	if len(args) == 0 || len(args) > 3 {
+		return "Usage: /chart <COIN> <" + chartIntervalNames() + "> [line|candles]"
+	}
+
+	if intervalPattern.MatchString(args[0]) {
+		return "Usage: /chart <COIN> <" + chartIntervalNames() + "> [line|candles]"
+	}
+
+	coin := strings.ToUpper(strings.Trim(args[0], "?"))
+	interval := ""
+	chartType := ChartTypeLine
+
+	for _, arg := range args[1:] {
+		if _, ok := getChartInterval(arg); ok {
+			interval = arg
+			continue
+		}
+
+		if intervalPattern.MatchString(arg) {
+			return "Unknown interval " + arg + ", use " + chartIntervalNames()
+		}
+
+		switch strings.ToLower(arg) {
+		case ChartTypeCandles, "candle":
+			chartType = ChartTypeCandles
+		case ChartTypeLine:
+			chartType = ChartTypeLine
+		default:
+			return "Unknown option " + arg + ", use " + chartIntervalNames() + ", line or candles"
+		}
+	}
+
+	graph, err := renderChart(coin, subscriber.getQuote(), interval, chartType)
+	if err != nil {
+		log.Warnf("can't render coin graph: %v", err)
+		return "Возникла ошибка №435/12"
+	}
+
+	if graph == nil {
+		return "No data for " + pairName(coin, subscriber.getQuote())
+	}
+
+	sendGraph(ctx, bot, subscriber.TelegramId, graph)
+
+	return ""
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func flatMarketData(volume float64) *MemoryMarketData {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var klines []Kline
+	for i := 20; i > 0; i-- {
+		open := now.Add(-time.Duration(i) * 15 * time.Minute)
+		klines = append(klines, Kline{
+			CoinPairId:       1,
+			OpenTime:         open,
+			CloseTime:        open.Add(15*time.Minute - time.Millisecond),
+			Open:             1,
+			High:             1,
+			Low:              1,
+			Close:            1,
+			QuoteAssetVolume: volume,
+		})
+	}
+
+	repository := newMemoryMarketData([]MemoryCoin{{Id: 1, Code: "USDC", Quote: "BUSD", Rank: 1, Klines: klines}})
+	repository.Now = func() time.Time {
+		return now
+	}
+
+	return repository
+}
+
+func TestRenderFlatRange(t *testing.T) {
+	setConfig(Config{Quotes: []string{"BUSD"}})
+
+	renderers := map[string]func() ([]byte, error){
+		"candles": func() ([]byte, error) { return renderCandlestickGraph("USDC", "BUSD", "") },
+		"line":    func() ([]byte, error) { return renderCoinGraph("USDC", "BUSD", "") },
+		"volume":  func() ([]byte, error) { return renderVolumeGraph("USDC", "BUSD") },
+		"compare": func() ([]byte, error) { return renderCompareGraph([]string{"USDC", "USDC"}, "BUSD", "") },
+	}
+
+	for _, volume := range []float64{10, 0} {
+		marketData = flatMarketData(volume)
+
+		for name, render := range renderers {
+			graph, err := render()
+			if err != nil || len(graph) == 0 {
+				t.Errorf("%s with volume %v: got %d bytes, %v", name, volume, len(graph), err)
+			}
+		}
+	}
+}
+
+func TestPadRange(t *testing.T) {
+	tests := []struct {
+		min, max         float64
+		wantMin, wantMax float64
+	}{
+		{1, 2, 1, 2},
+		{100, 100, 99, 101},
+		{0, 0, -1, 1},
+		{-50, -50, -50.5, -49.5},
+	}
+
+	for _, test := range tests {
+		min, max := padRange(test.min, test.max)
+		if min != test.wantMin || max != test.wantMax {
+			t.Errorf("padRange(%v, %v) = %v, %v, want %v, %v", test.min, test.max, min, max, test.wantMin, test.wantMax)
+		}
+	}
+}
+
+func TestChartCommandsRejectUnsupportedIntervals(t *testing.T) {
+	subscriber := &Subscriber{Id: 1, TelegramId: 1, Quote: "BUSD"}
+
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{"chart", handleChartCommand(context.Background(), nil, subscriber, "BTC 2h"), "Unknown interval 2h"},
+		{"chart interval first", handleChartCommand(context.Background(), nil, subscriber, "2h"), "Usage: /chart"},
+		{"chart option", handleChartCommand(context.Background(), nil, subscriber, "BTC bars"), "Unknown option bars"},
+		{"compare", handleCompareCommand(context.Background(), nil, subscriber, "BTC ETH 3d"), "Unknown interval 3d"},
+		{"compare minutes", handleCompareCommand(context.Background(), nil, subscriber, "BTC 5min ETH"), "Unknown interval 5min"},
+	}
+
+	for _, test := range tests {
+		if !strings.HasPrefix(test.reply, test.want) {
+			t.Errorf("%s: got %q, want %q...", test.name, test.reply, test.want)
+		}
+	}
+
+	if !intervalPattern.MatchString("1W") || intervalPattern.MatchString("1INCH") {
+		t.Error("1INCH is a coin, 1W is an interval")
+	}
+}
+
+func TestChartCommandWithoutData(t *testing.T) {
+	setConfig(Config{Quotes: []string{"BUSD"}})
+	testMarketData(t)
+	subscriber := &Subscriber{Id: 1, TelegramId: 1, Quote: "BUSD"}
+
+	for _, arguments := range []string{"XRP", "XRP 7d candles"} {
+		if reply := handleChartCommand(context.Background(), nil, subscriber, arguments); reply != "No data for XRP/BUSD" {
+			t.Errorf("%s: got %q, want No data for XRP/BUSD", arguments, reply)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/wcharczuk/go-chart"
+	"strings"
+)
+
+const compareCoinsLimit = 5
+
+func rebaseToPercent(values []float64) []float64 {
+	result := make([]float64, len(values))
+
+	if len(values) == 0 || values[0] == 0 {
+		return result
+	}
+
+	for i, value := range values {
+		result[i] = (value - values[0]) / values[0] * 100
+	}
+
+	return result
+}
+
+func renderCompareGraph(coins []string, quote string, interval string) ([]byte, error) {
+	var series []chart.Series
+	var all []float64
+
+	for _, coin := range coins {
+		xv, yv, _ := getDataForCoinGraph(coin, quote, interval)
+
+		if len(xv) == 0 {
+			continue
+		}
+
+		percents := rebaseToPercent(yv)
+		all = append(all, percents...)
+
+		series = append(series, chart.TimeSeries{
+			Name: coin + " " + FloatToStr(percents[len(percents)-1]) + "%",
+			Style: chart.Style{
+				Show:        true,
+				StrokeColor: chart.GetDefaultColor(len(series)),
+				StrokeWidth: 2,
+			},
+			XValues: xv,
+			YValues: percents,
+		})
+	}
+
+	if len(series) == 0 {
+		return nil, nil
+	}
+
+	min, max := padRange(findMinAndMax(all))
+
+	graph := chart.Chart{
+		Title:      strings.Join(coins, ", ") + " (" + quote + ") " + chartIntervalName(interval),
+		TitleStyle: chart.Style{Show: true},
+		XAxis: chart.XAxis{
+			Style:        chart.Style{Show: true},
+			TickPosition: chart.TickPositionBetweenTicks,
+		},
+		YAxis: chart.YAxis{
+			Style: chart.Style{Show: true},
+			ValueFormatter: func(v interface{}) string {
+				return chart.FloatValueFormatter(v) + "%"
+			},
+			Range: &chart.ContinuousRange{
+				Max: max,
+				Min: min,
+			},
+		},
+		Series: series,
+	}
+
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph),
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func handleCompareCommand(ctx context.Context, bot *tgbotapi.BotAPI, subscriber *Subscriber, arguments string) string {
+	var coins []string
+	interval := ""
+
+	for _, arg := range strings.Fields(arguments) {
+		if _, ok := getChartInterval(arg); ok {
+			interval = arg
+			continue
+		}
+
+		if intervalPattern.MatchString(arg) {
+			return "Unknown interval " + arg + ", use " + chartIntervalNames()
+		}
+
+		coin := strings.ToUpper(strings.Trim(arg, ",?"))
+		if coin != "" && !containsString(coins, coin) {
+			coins = append(coins, coin)
+		}
+	}
+
+	if len(coins) < 2 || len(coins) > compareCoinsLimit {
+		return "Usage: /compare BTC ETH SOL 24h, from 2 to " + IntToStr(compareCoinsLimit) + " coins"
+	}
+
+	graph, err := renderCompareGraph(coins, subscriber.getQuote(), interval)
+	if err != nil {
+		log.Warnf("can't render compare graph: %v", err)
+		return "Возникла ошибка №435/7"
+	}
+
+	if graph == nil {
+		return "No data for " + strings.Join(coins, ", ")
+	}
+
+	sendGraph(ctx, bot, subscriber.TelegramId, graph)
+
+	return ""
+}
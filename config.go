@@ -2,14 +2,50 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/mail"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
 )
 
-var appConfig Config
+const (
+	defaultConfigPath = "config.json"
+	configEnvPrefix   = "TRADER"
+)
+
+// appConfig holds the current Config, it is replaced as a whole on reload.
+var appConfig atomic.Value
+
+// appConfigPath is set by the -config flag.
+var appConfigPath = defaultConfigPath
+
+var defaultQuietHours = QuietHours{From: 2, To: 7}
 
 type Config struct {
 	TelegramBot string `json:"telegram-bot"`
+	// TelegramApi is the Bot API server, a local Bot API server or a fake one in tests.
+	TelegramApi string `json:"telegram-api"`
 	Db          Db
+	Smtp        Smtp
+	Thresholds  Thresholds
+	Cooldown    Cooldown
+	// Quotes are the quote assets of the coins pairs, the first one is the default for subscribers.
+	Quotes     []string
+	QuietHours QuietHours
+	LogLevel   string
+	Jobs       []JobConfig
+	Outbox     Outbox
+	// AdvisoryLock makes every job run take a Postgres advisory lock, so one of several replicas runs it.
+	AdvisoryLock bool
+	// Admins are the telegram ids allowed to use the admin commands.
+	Admins []int64
 }
 
 type Db struct {
@@ -20,17 +56,328 @@ type Db struct {
 	Dbname string
 }
 
-func readConfig() {
-	file, err := os.Open("config.json")
+// Outbox is read on start, MaxAttempts is applied on reload too.
+type Outbox struct {
+	Workers     int
+	MaxAttempts int
+}
+
+type Smtp struct {
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+}
+
+// QuietHours is the local time range [From, To) without notifications, equal hours disable it.
+// The config one is the default for subscribers that have not set their own with /settings.
+type QuietHours struct {
+	From int
+	To   int
+}
 
+func (q QuietHours) contains(hour int) bool {
+	if q.From == q.To {
+		return false
+	}
+	if q.From < q.To {
+		return hour >= q.From && hour < q.To
+	}
+	return hour >= q.From || hour < q.To
+}
+
+type Cooldown struct {
+	Minutes int
+	// Escalation is how many times a move must grow to be repeated within the cooldown.
+	Escalation float64
+}
+
+func getConfig() Config {
+	config, _ := appConfig.Load().(Config)
+	return config
+}
+
+func setConfig(config Config) {
+	appConfig.Store(config)
+
+	if level, err := logrus.ParseLevel(config.LogLevel); err == nil {
+		log.SetLevel(level)
+	}
+}
+
+func readConfig() error {
+	config, err := loadConfig(appConfigPath)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	setConfig(config)
+
+	return nil
+}
+
+// loadConfig reads the config file, then every field can be overridden from TRADER_<SECTION>_<FIELD>
+// or read from the file named by TRADER_<SECTION>_<FIELD>_FILE, jobs are a json array merged by name.
+// The default config file may be missing.
+func loadConfig(path string) (Config, error) {
+	config := Config{
+		Thresholds:  defaultThresholds,
+		Cooldown:    defaultCooldown,
+		QuietHours:  defaultQuietHours,
+		Outbox:      defaultOutbox,
+		TelegramApi: defaultTelegramApi,
+		LogLevel:    "info",
+	}
+	var problems []string
+
+	file, err := os.Open(path)
+	switch {
+	case err == nil:
+		err = json.NewDecoder(file).Decode(&config)
+		file.Close()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+		}
+	case os.IsNotExist(err) && path == defaultConfigPath:
+	default:
+		problems = append(problems, err.Error())
+	}
+
+	applyConfigEnv(reflect.ValueOf(&config).Elem(), configEnvPrefix, &problems)
+
+	config.Jobs = mergeJobs(defaultJobs, config.Jobs)
+
+	if len(config.Quotes) == 0 {
+		config.Quotes = append([]string(nil), defaultQuotes...)
+	}
+	for i, quote := range config.Quotes {
+		config.Quotes[i] = strings.ToUpper(strings.TrimSpace(quote))
+	}
+
+	problems = append(problems, config.validate()...)
+
+	if len(problems) > 0 {
+		return config, errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return config, nil
+}
+
+func (c Config) validate() []string {
+	var problems []string
+
+	if c.TelegramBot == "" {
+		problems = append(problems, "telegram-bot is required ("+configEnvPrefix+"_TELEGRAM_BOT)")
+	}
+
+	if u, err := url.Parse(c.TelegramApi); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "telegram-api must be an http or https url ("+configEnvPrefix+"_TELEGRAM_API)")
+	}
+
+	if c.Db.Host == "" {
+		problems = append(problems, "db.host is required ("+configEnvPrefix+"_DB_HOST)")
+	}
+	if c.Db.Port <= 0 || c.Db.Port > 65535 {
+		problems = append(problems, "db.port must be between 1 and 65535 ("+configEnvPrefix+"_DB_PORT)")
 	}
+	if c.Db.User == "" {
+		problems = append(problems, "db.user is required ("+configEnvPrefix+"_DB_USER)")
+	}
+	if c.Db.Dbname == "" {
+		problems = append(problems, "db.dbname is required ("+configEnvPrefix+"_DB_DBNAME)")
+	}
+
+	if c.Smtp.Host != "" {
+		if c.Smtp.Port <= 0 || c.Smtp.Port > 65535 {
+			problems = append(problems, "smtp.port must be between 1 and 65535 ("+configEnvPrefix+"_SMTP_PORT)")
+		}
+		if _, err := mail.ParseAddress(c.Smtp.From); err != nil {
+			problems = append(problems, "smtp.from must be an email address ("+configEnvPrefix+"_SMTP_FROM)")
+		}
+	}
+
+	thresholds := []struct {
+		name  string
+		value float64
+	}{
+		{"minute10", c.Thresholds.Minute10},
+		{"hour", c.Thresholds.Hour},
+		{"hour4", c.Thresholds.Hour4},
+		{"hour12", c.Thresholds.Hour12},
+		{"hour24", c.Thresholds.Hour24},
+		{"percentSum", c.Thresholds.PercentSum},
+		{"volumeSpike", c.Thresholds.VolumeSpike},
+		{"tradeSpike", c.Thresholds.TradeSpike},
+	}
+	for _, threshold := range thresholds {
+		if threshold.value < 0 {
+			problems = append(problems, "thresholds."+threshold.name+" must not be negative")
+		}
+	}
+
+	if c.Cooldown.Minutes < 0 {
+		problems = append(problems, "cooldown.minutes must not be negative")
+	}
+	if c.Cooldown.Minutes > 0 && c.Cooldown.Escalation < 1 {
+		problems = append(problems, "cooldown.escalation must be at least 1")
+	}
+
+	if c.QuietHours.From < 0 || c.QuietHours.From > 23 || c.QuietHours.To < 0 || c.QuietHours.To > 23 {
+		problems = append(problems, "quietHours.from and quietHours.to must be between 0 and 23")
+	}
+
+	if c.Outbox.Workers < 1 {
+		problems = append(problems, "outbox.workers must be at least 1")
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		problems = append(problems, "outbox.maxAttempts must be at least 1")
+	}
+
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		problems = append(problems, "logLevel must be one of panic, fatal, error, warn, info, debug, trace")
+	}
+
+	problems = append(problems, validateJobs(c.Jobs)...)
+
+	for _, quote := range c.Quotes {
+		if quote == "" {
+			problems = append(problems, "quotes must not contain empty values")
+			break
+		}
+	}
+
+	return problems
+}
+
+func applyConfigEnv(value reflect.Value, prefix string, problems *[]string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
 
-	decoder := json.NewDecoder(file)
-	appConfig = *(new(Config))
-	err = decoder.Decode(&appConfig)
+		name := prefix
+		if !field.Anonymous {
+			name += "_" + configEnvName(field)
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			applyConfigEnv(value.Field(i), name, problems)
+			continue
+		}
+
+		raw, ok, err := lookupConfigEnv(name)
+		if err != nil {
+			*problems = append(*problems, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setConfigValue(value.Field(i), raw); err != nil {
+			*problems = append(*problems, name+": "+err.Error())
+		}
+	}
+}
+
+// lookupConfigEnv reads NAME or the content of the file at NAME_FILE.
+func lookupConfigEnv(name string) (string, bool, error) {
+	raw, ok := os.LookupEnv(name)
+	path, fileOk := os.LookupEnv(name + "_FILE")
+
+	if ok && fileOk {
+		return "", false, errors.New(name + " and " + name + "_FILE are both set")
+	}
+
+	if !fileOk {
+		return raw, ok, nil
+	}
+
+	content, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return "", false, fmt.Errorf("%s_FILE: %v", name, err)
 	}
+
+	return strings.TrimSpace(string(content)), true, nil
+}
+
+func setConfigValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		value.SetInt(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		value.SetFloat(number)
+	case reflect.Bool:
+		flag, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		value.SetBool(flag)
+	case reflect.Slice:
+		kind := value.Type().Elem().Kind()
+		// a list of sections, like jobs, is the json of the config file
+		if kind == reflect.Struct {
+			items := reflect.New(value.Type())
+			if err := json.Unmarshal([]byte(raw), items.Interface()); err != nil {
+				return errors.New("must be a json array: " + err.Error())
+			}
+			value.Set(items.Elem())
+			return nil
+		}
+		if kind != reflect.String && (kind < reflect.Int || kind > reflect.Int64) {
+			return errors.New("can't be set from the environment")
+		}
+		items := reflect.MakeSlice(value.Type(), 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			element := reflect.New(value.Type().Elem()).Elem()
+			if err := setConfigValue(element, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, element)
+		}
+		value.Set(items)
+	default:
+		return errors.New("can't be set from the environment")
+	}
+
+	return nil
+}
+
+// configEnvName turns the json name or the field name into upper snake case, TelegramBot -> TELEGRAM_BOT.
+func configEnvName(field reflect.StructField) string {
+	name := field.Name
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+		name = tag
+	}
+
+	var builder strings.Builder
+	runes := []rune(name)
+
+	for i, r := range runes {
+		switch {
+		case r == '-' || r == '.':
+			builder.WriteRune('_')
+			continue
+		case i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]):
+			builder.WriteRune('_')
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+
+	return builder.String()
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{
+		"telegram-bot": "file-token",
+		"db": {"host": "localhost", "port": 5436, "user": "dbuser", "pass": "file-pass", "dbname": "trader_db"},
+		"thresholds": {"hour": 3, "percentSum": 2},
+		"jobs": [{"name": "volume", "disabled": true}]
+	}`)
+
+	t.Setenv("TRADER_TELEGRAM_BOT", "env-token")
+	t.Setenv("TRADER_DB_HOST", "postgres")
+	t.Setenv("TRADER_DB_PASS_FILE", writeConfigFile(t, "db-pass", "secret\n"))
+	t.Setenv("TRADER_THRESHOLDS_PERCENT_SUM", "3.5")
+	t.Setenv("TRADER_QUOTES", " usdt, fdusd,")
+	t.Setenv("TRADER_ADMINS", "10,20")
+	t.Setenv("TRADER_ADVISORY_LOCK", "true")
+	t.Setenv("TRADER_JOBS", `[{"name": "movers", "schedule": "*/15 * * * *"}]`)
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the environment wins over the file, the rest of the file is kept
+	if config.TelegramBot != "env-token" || config.Db.Host != "postgres" || config.Db.Port != 5436 || config.Db.Pass != "secret" {
+		t.Errorf("got bot %q, db %+v", config.TelegramBot, config.Db)
+	}
+	if config.Thresholds.PercentSum != 3.5 || config.Thresholds.Hour != 3 {
+		t.Errorf("got thresholds %+v", config.Thresholds)
+	}
+	if strings.Join(config.Quotes, ",") != "USDT,FDUSD" || len(config.Admins) != 2 || config.Admins[1] != 20 || !config.AdvisoryLock {
+		t.Errorf("got quotes %v, admins %v, lock %v", config.Quotes, config.Admins, config.AdvisoryLock)
+	}
+
+	// the defaults fill what neither sets
+	if config.Outbox != defaultOutbox || config.QuietHours != defaultQuietHours || config.TelegramApi != defaultTelegramApi {
+		t.Errorf("got outbox %+v, quiet hours %+v, api %q", config.Outbox, config.QuietHours, config.TelegramApi)
+	}
+
+	// the jobs of the environment replace the ones of the file and are merged with the defaults
+	if len(config.Jobs) != len(defaultJobs) {
+		t.Fatalf("got %d jobs, want %d", len(config.Jobs), len(defaultJobs))
+	}
+	for _, job := range config.Jobs {
+		switch job.Name {
+		case JobMovers:
+			if job.Schedule != "*/15 * * * *" || job.Timeout != "10m" {
+				t.Errorf("got movers %+v", job)
+			}
+		case JobVolume:
+			if job.Disabled {
+				t.Errorf("got volume %+v, want the file job replaced", job)
+			}
+		}
+	}
+}
+
+func TestLoadConfigProblems(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{
+		"db": {"host": "localhost", "port": 70000, "dbname": "trader_db"},
+		"thresholds": {"hour": -1},
+		"quietHours": {"from": 25},
+		"logLevel": "loud",
+		"jobs": [{"name": "movers", "schedule": "61 * * * *"}]
+	}`)
+
+	t.Setenv("TRADER_TELEGRAM_BOT", "token")
+	t.Setenv("TRADER_TELEGRAM_BOT_FILE", "/run/secrets/bot-token")
+	t.Setenv("TRADER_DB_USER_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("TRADER_COOLDOWN_MINUTES", "soon")
+	t.Setenv("TRADER_JOBS", `{"name": "movers"}`)
+
+	_, err := loadConfig(path)
+	if err == nil {
+		t.Fatal("want an error")
+	}
+
+	// every problem is reported at once
+	for _, want := range []string{
+		"TRADER_TELEGRAM_BOT and TRADER_TELEGRAM_BOT_FILE are both set",
+		"TRADER_DB_USER_FILE: ",
+		"TRADER_COOLDOWN_MINUTES: must be an integer",
+		"TRADER_JOBS: must be a json array",
+		"telegram-bot is required",
+		"db.port must be between 1 and 65535",
+		"db.user is required",
+		"thresholds.hour must not be negative",
+		"quietHours.from and quietHours.to must be between 0 and 23",
+		"logLevel must be one of",
+		`cron "61 * * * *"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want %q", err, want)
+		}
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("want an error for a missing config file that isn't the default one")
+	}
+}
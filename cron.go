@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 are sunday
+}
+
+// CronSchedule is a parsed "minute hour day-of-month month day-of-week" expression.
+type CronSchedule struct {
+	expression string
+	fields     [5]uint64
+	// anyDay is set when day of month or day of week is *, otherwise a day matches either of them
+	anyDay bool
+}
+
+func parseCron(expression string) (*CronSchedule, error) {
+	expression = strings.TrimSpace(expression)
+
+	spec := expression
+	if descriptor, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron %q must have 5 fields", expression)
+	}
+
+	schedule := &CronSchedule{expression: expression}
+
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %v", expression, err)
+		}
+		schedule.fields[i] = bits
+	}
+
+	// 7 is sunday too
+	if schedule.fields[4]&(1<<7) != 0 {
+		schedule.fields[4] |= 1
+	}
+
+	schedule.anyDay = strings.HasPrefix(parts[2], "*") || strings.HasPrefix(parts[4], "*")
+
+	return schedule, nil
+}
+
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(value, ",") {
+		rangePart, step := item, 1
+
+		if slash := strings.Index(item, "/"); slash >= 0 {
+			var err error
+			rangePart = item[:slash]
+			step, err = strconv.Atoi(item[slash+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", item)
+			}
+		}
+
+		from, to := field.min, field.max
+
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+
+			var err error
+			from, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", item)
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", item)
+				}
+			} else if step > 1 {
+				to = field.max
+			}
+		}
+
+		if from < field.min || to > field.max || from > to {
+			return 0, fmt.Errorf("%q is out of range %d-%d", item, field.min, field.max)
+		}
+
+		for i := from; i <= to; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func (s *CronSchedule) String() string {
+	return s.expression
+}
+
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	dayOfMonth := s.fields[2]&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.fields[4]&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDay {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// Next returns the first matching minute after t, or zero time when nothing matches within five years.
+// The fields match the wall clock of t's location: a time skipped by a DST change is shifted forward with the
+// clock, a repeated time runs once.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	location := t.Location()
+
+	// the wall clock in UTC has no DST changes
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := wall.AddDate(5, 0, 0)
+
+	for wall.Before(limit) {
+		if s.fields[3]&(1<<uint(wall.Month())) == 0 {
+			wall = time.Date(wall.Year(), wall.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if !s.matchDay(wall) {
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if s.fields[1]&(1<<uint(wall.Hour())) == 0 {
+			wall = wall.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+
+		if s.fields[0]&(1<<uint(wall.Minute())) == 0 {
+			wall = wall.Add(time.Minute)
+			continue
+		}
+
+		next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, location)
+		if !next.After(t) {
+			wall = wall.Add(time.Minute)
+			continue
+		}
+
+		return next
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 5m",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%q: want an error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	// 2022-01-01 is a saturday
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []string
+	}{
+		{"every minute", "* * * * *", utc(2022, 1, 1, 10, 7).Add(30 * time.Second), []string{"2022-01-01 10:08 UTC", "2022-01-01 10:09 UTC"}},
+		{"step", "*/15 * * * *", utc(2022, 1, 1, 10, 7), []string{"2022-01-01 10:15 UTC", "2022-01-01 10:30 UTC", "2022-01-01 10:45 UTC", "2022-01-01 11:00 UTC"}},
+		{"range with step", "5-10/2 * * * *", utc(2022, 1, 1, 10, 6), []string{"2022-01-01 10:07 UTC", "2022-01-01 10:09 UTC", "2022-01-01 11:05 UTC"}},
+		{"value with step", "50/5 * * * *", utc(2022, 1, 1, 10, 0), []string{"2022-01-01 10:50 UTC", "2022-01-01 10:55 UTC", "2022-01-01 11:50 UTC"}},
+		{"list of ranges", "0,30 9-10,17 * * *", utc(2022, 1, 1, 10, 30), []string{"2022-01-01 17:00 UTC", "2022-01-01 17:30 UTC", "2022-01-02 09:00 UTC"}},
+		{"weekdays", "0 12 * * 1-5", utc(2022, 1, 7, 13, 0), []string{"2022-01-10 12:00 UTC", "2022-01-11 12:00 UTC"}},
+		{"sunday as 0", "0 12 * * 0", utc(2022, 1, 3, 0, 0), []string{"2022-01-09 12:00 UTC"}},
+		{"sunday as 7", "0 12 * * 7", utc(2022, 1, 3, 0, 0), []string{"2022-01-09 12:00 UTC"}},
+		{"day of month and any weekday", "0 0 13 * *", utc(2022, 1, 1, 0, 0), []string{"2022-01-13 00:00 UTC", "2022-02-13 00:00 UTC"}},
+		{"day of month or weekday", "0 0 13 * 5", utc(2022, 1, 1, 0, 0), []string{"2022-01-07 00:00 UTC", "2022-01-13 00:00 UTC", "2022-01-14 00:00 UTC"}},
+		{"month end", "0 0 31 * *", utc(2022, 1, 31, 0, 0), []string{"2022-03-31 00:00 UTC", "2022-05-31 00:00 UTC"}},
+		{"year end", "0 0 1 * *", utc(2022, 12, 31, 12, 0), []string{"2023-01-01 00:00 UTC"}},
+		{"leap day", "0 0 29 2 *", utc(2022, 3, 1, 0, 0), []string{"2024-02-29 00:00 UTC", "2028-02-29 00:00 UTC"}},
+		{"descriptor", "@weekly", utc(2022, 1, 1, 10, 0), []string{"2022-01-02 00:00 UTC", "2022-01-09 00:00 UTC"}},
+		{"never", "0 0 30 2 *", utc(2022, 1, 1, 0, 0), []string{"0001-01-01 00:00 UTC"}},
+
+		// the clock jumps from 02:00 to 03:00 on 2022-03-27 and back from 03:00 to 02:00 on 2022-10-30
+		{"skipped time", "30 2 * * *", time.Date(2022, 3, 26, 12, 0, 0, 0, berlin), []string{"2022-03-27 03:30 CEST", "2022-03-28 02:30 CEST"}},
+		{"skipped hour", "*/30 * * * *", time.Date(2022, 3, 27, 1, 15, 0, 0, berlin), []string{"2022-03-27 01:30 CET", "2022-03-27 03:00 CEST", "2022-03-27 03:30 CEST"}},
+		{"repeated time", "30 2 * * *", time.Date(2022, 10, 29, 12, 0, 0, 0, berlin), []string{"2022-10-30 02:30 CET", "2022-10-31 02:30 CET"}},
+		{"from the first repeated hour", "30 2 * * *", time.Date(2022, 10, 30, 0, 10, 0, 0, time.UTC).In(berlin), []string{"2022-10-30 02:30 CET", "2022-10-31 02:30 CET"}},
+		{"daily across the change", "0 10 * * *", time.Date(2022, 10, 29, 10, 0, 0, 0, berlin), []string{"2022-10-30 10:00 CET", "2022-10-31 10:00 CET"}},
+	}
+
+	for _, test := range tests {
+		schedule, err := parseCron(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		next := test.from
+		for i, want := range test.want {
+			next = schedule.Next(next)
+			if got := next.Format("2006-01-02 15:04 MST"); got != want {
+				t.Errorf("%s: run %d got %s, want %s", test.name, i, got, want)
+				break
+			}
+		}
+	}
+}
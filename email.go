@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+const emailSubject = "Coins notification"
+
+type EmailNotifier struct {
+	host string
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func newEmailNotifier(config Smtp) *EmailNotifier {
+	notifier := &EmailNotifier{
+		host: config.Host,
+		addr: config.Host + ":" + strconv.Itoa(config.Port),
+		from: config.From,
+	}
+
+	if config.User != "" {
+		notifier.auth = smtp.PlainAuth("", config.User, config.Pass, config.Host)
+	}
+
+	return notifier
+}
+
+func (n *EmailNotifier) SendText(ctx context.Context, subscriber *Subscriber, text string) error {
+	return n.SendReport(ctx, subscriber, text, nil)
+}
+
+func (n *EmailNotifier) SendImage(ctx context.Context, subscriber *Subscriber, image []byte) error {
+	return n.SendReport(ctx, subscriber, "Chart attached", image)
+}
+
+func (n *EmailNotifier) SendReport(ctx context.Context, subscriber *Subscriber, text string, image []byte) error {
+	if subscriber.Email == "" {
+		return errNotApplicable
+	}
+
+	message, err := buildEmail(n.from, subscriber.Email, emailSubject, text, image)
+	if err != nil {
+		return err
+	}
+
+	err = n.sendMail(ctx, subscriber.Email, message)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// sendMail is smtp.SendMail over a connection that is closed when ctx is done.
+func (n *EmailNotifier) sendMail(ctx context.Context, to string, message []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (n *EmailNotifier) Channel() string {
+	return "email"
+}
+
+func (n *EmailNotifier) ClassifyError(err error) *SendError {
+	return classifySmtpError(err)
+}
+
+func buildEmail(from string, to string, subject string, text string, image []byte) ([]byte, error) {
+	var body bytes.Buffer
+
+	var parts bytes.Buffer
+
+	mixed := multipart.NewWriter(&body)
+	alternative := multipart.NewWriter(&parts)
+
+	if err := writeQuotedPart(alternative, "text/plain; charset=utf-8", text); err != nil {
+		return nil, err
+	}
+
+	if err := writeQuotedPart(alternative, "text/html; charset=utf-8", "<html><body><pre>"+html.EscapeString(text)+"</pre></body></html>"); err != nil {
+		return nil, err
+	}
+
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := part.Write(parts.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if image != nil {
+		part, err = mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {`attachment; filename="chart.png"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := part.Write(wrapBase64(image)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+func writeQuotedPart(writer *multipart.Writer, contentType string, content string) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func wrapBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var result bytes.Buffer
+	for len(encoded) > 76 {
+		result.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	result.WriteString(encoded + "\r\n")
+
+	return result.Bytes()
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// SmtpMessage is a message received by SmtpStub.
+type SmtpMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// SmtpStub is a local SMTP server without TLS and auth, it keeps the received messages.
+type SmtpStub struct {
+	listener net.Listener
+	messages chan SmtpMessage
+	// rejectRcpt is the reply to RCPT TO when set, like "550 5.1.1 mailbox unavailable"
+	rejectRcpt string
+}
+
+func newSmtpStub(t *testing.T) *SmtpStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &SmtpStub{listener: listener, messages: make(chan SmtpMessage, 10)}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	return stub
+}
+
+func (s *SmtpStub) config() Smtp {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return Smtp{Host: addr.IP.String(), Port: addr.Port, From: "bot@example.com"}
+}
+
+func (s *SmtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	message := SmtpMessage{}
+
+	text.PrintfLine("220 localhost stub")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.From = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if s.rejectRcpt != "" {
+				text.PrintfLine("%s", s.rejectRcpt)
+				continue
+			}
+			message.To = append(message.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 end with <CRLF>.<CRLF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			message.Data = data
+			s.messages <- message
+			message = SmtpMessage{}
+			text.PrintfLine("250 OK")
+		case command == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *SmtpStub) waitMessage(t *testing.T) SmtpMessage {
+	t.Helper()
+
+	select {
+	case message := <-s.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return SmtpMessage{}
+	}
+}
+
+func TestEmailNotifierSendsReport(t *testing.T) {
+	stub := newSmtpStub(t)
+	notifier := newEmailNotifier(stub.config())
+
+	text := "Coins, BUSD.\nBTC 5% <up>"
+	if err := notifier.SendReport(context.Background(), &Subscriber{Id: 1, Email: "user@example.com"}, text, testImage); err != nil {
+		t.Fatal(err)
+	}
+
+	received := stub.waitMessage(t)
+	if received.From != "bot@example.com" || len(received.To) != 1 || received.To[0] != "user@example.com" {
+		t.Errorf("got envelope from %q to %v", received.From, received.To)
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(received.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{
+		"From":         "bot@example.com",
+		"To":           "user@example.com",
+		"Subject":      emailSubject,
+		"Mime-Version": "1.0",
+	}
+	for name, want := range headers {
+		if got := message.Header.Get(name); got != want {
+			t.Errorf("header %s: got %q, want %q", name, got, want)
+		}
+	}
+	if _, err := message.Header.Date(); err != nil {
+		t.Errorf("header Date: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("got content type %q: %v", mediaType, err)
+	}
+
+	parts := readParts(t, message.Body, params["boundary"])
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want text and chart", len(parts))
+	}
+
+	mediaType, params, _ = mime.ParseMediaType(parts[0].header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("got first part %q, want multipart/alternative", mediaType)
+	}
+
+	alternatives := readParts(t, bytes.NewReader(parts[0].body), params["boundary"])
+	if len(alternatives) != 2 {
+		t.Fatalf("got %d alternatives, want plain and html", len(alternatives))
+	}
+
+	bodies := make(map[string]string)
+	for _, part := range alternatives {
+		if got := part.header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+			t.Errorf("got transfer encoding %q", got)
+		}
+		decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(part.body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.header.Get("Content-Type"))
+		bodies[mediaType] = string(decoded)
+	}
+	if bodies["text/plain"] != text {
+		t.Errorf("got plain text %q", bodies["text/plain"])
+	}
+	if !strings.Contains(bodies["text/html"], "<pre>Coins, BUSD.\nBTC 5% &lt;up&gt;</pre>") {
+		t.Errorf("got html %q", bodies["text/html"])
+	}
+
+	chart := parts[1]
+	if got := chart.header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("got chart type %q", got)
+	}
+	if got := chart.header.Get("Content-Disposition"); got != `attachment; filename="chart.png"` {
+		t.Errorf("got chart disposition %q", got)
+	}
+	image, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(chart.body), "\r\n", ""))
+	if err != nil || !bytes.Equal(image, testImage) {
+		t.Errorf("got chart %q: %v", image, err)
+	}
+}
+
+func TestEmailNotifierRejectedMailbox(t *testing.T) {
+	stub := newSmtpStub(t)
+	stub.rejectRcpt = "550 5.1.1 mailbox unavailable"
+	notifier := newEmailNotifier(stub.config())
+
+	err := notifier.SendText(context.Background(), &Subscriber{Id: 1, Email: "gone@example.com"}, "text")
+	if err == nil {
+		t.Fatal("want an error for a rejected mailbox")
+	}
+
+	// a dead mailbox must not disable the subscriber
+	if sendErr := notifier.ClassifyError(err); sendErr.Kind != SendErrorRejected || sendErr.Code != 550 {
+		t.Errorf("got %s %d, want rejected 550", sendErr.Kind, sendErr.Code)
+	}
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func readParts(t *testing.T, body io.Reader, boundary string) []mimePart {
+	t.Helper()
+
+	var parts []mimePart
+	reader := multipart.NewReader(body, boundary)
+
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mimePart{header: part.Header, body: data})
+	}
+}
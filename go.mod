@@ -3,6 +3,7 @@ module go-trader
 go 1.17
 
 require (
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/go-pg/pg/v10 v10.9.0
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
@@ -10,7 +11,6 @@ require (
 )
 
 require (
-	github.com/fsnotify/fsnotify v1.5.1 // indirect
 	github.com/go-pg/zerochecker v0.2.0 // indirect
 	github.com/google/go-cmp v0.5.6 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"math"
 	"math/rand"
+	"strconv"
 )
 
 func IntToStr(number int) string {
@@ -13,6 +16,10 @@ func FloatToStr(number float64) string {
 	return fmt.Sprintf("%.2f", number)
 }
 
+func PriceToStr(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
+
 func findMinAndMax(a []float64) (min float64, max float64) {
 	min = a[0]
 	max = a[0]
@@ -27,6 +34,33 @@ func findMinAndMax(a []float64) (min float64, max float64) {
 	return min, max
 }
 
+// padRange widens a flat range by 1%, go-chart can't draw a zero y-range delta.
+func padRange(min float64, max float64) (float64, float64) {
+	if max > min {
+		return min, max
+	}
+
+	padding := math.Abs(max) / 100
+	if padding == 0 {
+		padding = 1
+	}
+
+	return min - padding, max + padding
+}
+
 func random(min, max float64) float64 {
 	return rand.Float64()*(max-min) + min
 }
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeText(text string) string {
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
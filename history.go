@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/go-pg/pg/v10"
+	"math"
+	"time"
+)
+
+var defaultCooldown = Cooldown{
+	Minutes:    120,
+	Escalation: 1.5,
+}
+
+type subscriberHistory struct {
+	fingerprints map[string]bool
+	coins        map[string]float64
+}
+
+// notificationHistory holds what each subscriber already got within the cooldown, keyed by subscriber id.
+type notificationHistory map[int64]*subscriberHistory
+
+func fingerprint(text string) string {
+	sum := sha1.Sum([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func newMoverLoggedCoin(coin PercentCoinShort) LoggedCoin {
+	direction := "up"
+	if coin.PercentSum < 0 {
+		direction = "down"
+	}
+
+	return LoggedCoin{Code: coin.Code, Direction: direction, Value: math.Abs(coin.PercentSum)}
+}
+
+// loadNotificationHistory reads the notifications of the cooldown, the ones held by quiet hours count too,
+// so every run doesn't hold the same coins again.
+func loadNotificationHistory(kind string, subscribers []Subscriber) (notificationHistory, error) {
+	history := make(notificationHistory)
+
+	if len(subscribers) == 0 || getConfig().Cooldown.Minutes <= 0 {
+		return history, nil
+	}
+
+	ids := make([]int64, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		ids = append(ids, subscriber.Id)
+	}
+
+	since := time.Now().Add(-time.Duration(getConfig().Cooldown.Minutes) * time.Minute)
+
+	var logs []NotificationsLogs
+	err := dbConnect.Model(&logs).
+		Column("subscriber_id", "fingerprint", "coins").
+		Where("kind = ?", kind).
+		// a dead notification still counts when one of its channels delivered it
+		Where("(status <> ? OR cardinality(delivered_channels) > 0)", NotificationStatusDead).
+		Where("subscriber_id IN (?)", pg.In(ids)).
+		Where("created_at >= ?", since).
+		Select()
+
+	if err != nil {
+		return history, err
+	}
+
+	for _, notification := range logs {
+		history.add(notification.SubscriberId, notification.Fingerprint, notification.Coins)
+	}
+
+	var queued []QueuedNotification
+	err = dbConnect.Model(&queued).
+		Column("subscriber_id", "notification", "coins").
+		Where("kind = ?", kind).
+		Where("subscriber_id IN (?)", pg.In(ids)).
+		Where("created_at >= ?", since).
+		Select()
+
+	if err != nil {
+		return history, err
+	}
+
+	for _, notification := range queued {
+		history.add(notification.SubscriberId, fingerprint(notification.Notification), notification.Coins)
+	}
+
+	return history, nil
+}
+
+// add keeps the biggest value of every coin and direction.
+func (h notificationHistory) add(subscriberId int64, fingerprint string, coins []LoggedCoin) {
+	item, ok := h[subscriberId]
+	if !ok {
+		item = &subscriberHistory{
+			fingerprints: make(map[string]bool),
+			coins:        make(map[string]float64),
+		}
+		h[subscriberId] = item
+	}
+
+	item.fingerprints[fingerprint] = true
+
+	for _, coin := range coins {
+		key := coin.Code + ":" + coin.Direction
+		if coin.Value > item.coins[key] {
+			item.coins[key] = coin.Value
+		}
+	}
+}
+
+func (h notificationHistory) isSent(subscriberId int64, text string) bool {
+	item, ok := h[subscriberId]
+	return ok && item.fingerprints[fingerprint(text)]
+}
+
+// isRepeated reports whether the coin was already sent in the same direction and has not escalated since.
+func (h notificationHistory) isRepeated(subscriberId int64, coin LoggedCoin) bool {
+	item, ok := h[subscriberId]
+	if !ok {
+		return false
+	}
+
+	previous, ok := item.coins[coin.Code+":"+coin.Direction]
+	if !ok {
+		return false
+	}
+
+	return coin.Value < previous*getConfig().Cooldown.Escalation
+}
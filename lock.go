@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+)
+
+// jobLockNamespace is the first key of the jobs advisory locks, the second one is the hash of the job name.
+const jobLockNamespace = 435
+
+// lockJob takes the advisory lock of the job on a dedicated connection when config.AdvisoryLock is set.
+// The lock lives as long as the connection, so a crashed replica releases it. ok is false when another replica holds it.
+func lockJob(ctx context.Context, job string) (unlock func(), ok bool, err error) {
+	if !getConfig().AdvisoryLock {
+		return func() {}, true, nil
+	}
+
+	conn := dbConnect.Conn()
+
+	_, err = conn.QueryOneContext(ctx, pg.Scan(&ok), "SELECT pg_try_advisory_lock(?, hashtext(?))", jobLockNamespace, job)
+	if err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+
+	return func() {
+		if _, err := conn.Exec("SELECT pg_advisory_unlock(?, hashtext(?))", jobLockNamespace, job); err != nil {
+			log.Warnf("can't unlock job %s: %v", job, err)
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// getJobLocks returns the jobs holding an advisory lock in any replica, this one included.
+func getJobLocks(jobs []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(jobs))
+
+	if !getConfig().AdvisoryLock || len(jobs) == 0 {
+		return result, nil
+	}
+
+	var locked []string
+	_, err := dbConnect.Query(&locked, `
+		SELECT name
+		FROM unnest(?0::text[]) AS name
+		WHERE EXISTS (
+			SELECT 1
+			FROM pg_locks l
+			WHERE l.locktype = 'advisory'
+			  AND l.granted
+			  AND l.classid = ?1
+			  AND l.objid = hashtext(name)::oid
+			  AND l.objsubid = 2
+		)`, pg.Array(jobs), jobLockNamespace)
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, job := range locked {
+		result[job] = true
+	}
+
+	return result, nil
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -13,9 +14,12 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/wcharczuk/go-chart"
 	"github.com/wcharczuk/go-chart/drawing"
+	"net/mail"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -23,14 +27,33 @@ var dbConnect pg.DB
 
 var log = logrus.New()
 
-var sendNotificationsIsWorking bool
-
 func main() {
+	flag.StringVar(&appConfigPath, "config", defaultConfigPath, "path to the config file")
+	flag.Parse()
+
 	setLogParam()
-	readConfig()
+
+	if err := readConfig(); err != nil {
+		fmt.Println(err)
+		log.Fatal(err)
+	}
 
 	dbInit()
 
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrateCommand(&dbConnect, flag.Args()[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	marketData = newPostgresMarketData(&dbConnect)
+
+	go watchConfig()
+
 	defer func() {
 		err := dbConnect.Close()
 		if err != nil {
@@ -39,36 +62,47 @@ func main() {
 		}
 	}()
 
+	bot, err := newTelegramBot(getConfig())
+	if err != nil {
+		log.Fatalf("telegram bot: %v", err)
+	}
+
+	botDone := make(chan struct{})
 	go func() {
-		telegramBot()
+		telegramBot(ctx, bot)
+		close(botDone)
 	}()
 
-	go func() {
-		for {
-			t := time.Now()
-			if t.Hour() == 10 {
-				sendConsolidationPeriod()
-				time.Sleep(24 * time.Hour)
-			}
+	outboxWorkers := startOutbox(ctx, bot, getConfig().Outbox.Workers)
 
-			time.Sleep(30 * time.Second)
-		}
-	}()
+	scheduler = newScheduler(map[string]func(ctx context.Context){
+		JobMovers:        sendNotifications,
+		JobVolume:        sendVolumeSpikes,
+		JobConsolidation: sendConsolidationPeriod,
+		JobPriceAlerts:   checkPriceAlerts,
+		JobQuietSummary:  sendQuietSummaries,
+	})
+	scheduler.reload(getConfig().Jobs)
 
-	//sendNotifications() // mutex если в данный момент еще в работе
+	onConfigReload(func(config Config) {
+		scheduler.reload(config.Jobs)
+	})
 
-	for {
-		t := time.Now()
+	scheduler.run(ctx)
 
-		if t.Hour() >= 2 && t.Hour() < 7 {
-			time.Sleep(1 * time.Hour) // temp
-		}
+	// the outbox workers and the bot stop on ctx meanwhile, all the stages share one deadline
+	log.Info("shutting down")
+	deadline := time.Now().Add(shutdownTimeout)
+	scheduler.shutdown(deadline)
 
-		if t.Minute() == 0 || t.Minute() == 30 {
-			sendNotifications() // mutex если в данный момент еще в работе
-		}
+	if !waitUntil(outboxWorkers, deadline) {
+		log.Warn("outbox workers did not stop in time")
+	}
 
-		time.Sleep(45 * time.Second)
+	select {
+	case <-botDone:
+	case <-time.After(time.Until(deadline)):
+		log.Warn("telegram bot did not stop in time")
 	}
 }
 
@@ -83,12 +117,7 @@ func setLogParam() {
 	}
 }
 
-func telegramBot() {
-	bot, err := tgbotapi.NewBotAPI(appConfig.TelegramBot)
-	if err != nil {
-		log.Panic(err)
-	}
-
+func telegramBot(ctx context.Context, bot *tgbotapi.BotAPI) {
 	var replyMarkup = tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
 			tgbotapi.NewKeyboardButton("Btc ❤️"),
@@ -100,8 +129,6 @@ func telegramBot() {
 		),
 	)
 
-	bot.Debug = false //!!!!
-
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
 	u := tgbotapi.NewUpdate(0)
@@ -109,7 +136,16 @@ func telegramBot() {
 
 	updates := bot.GetUpdatesChan(u)
 
-	for update := range updates {
+	for {
+		var update tgbotapi.Update
+
+		select {
+		case <-ctx.Done():
+			bot.StopReceivingUpdates()
+			return
+		case update = <-updates:
+		}
+
 		if update.Message == nil { // ignore any non-Message updates
 			continue
 		}
@@ -138,50 +174,126 @@ func telegramBot() {
 				msg.Text = "Привет " + update.Message.Chat.FirstName + " я буду присылать тебе уведомления о движениях монет"
 			case "status":
 				msg.Text = "I m ok"
+			case "thresholds", "threshold":
+				msg.Text = "```" + handleThresholdCommand(subscriber, update.Message.CommandArguments()) + "```"
+			case "watch":
+				msg.Text = "```" + handleWatchCommand(subscriber, update.Message.CommandArguments()) + "```"
+			case "unwatch":
+				msg.Text = "```" + handleUnwatchCommand(subscriber, update.Message.CommandArguments()) + "```"
+			case "watchlist":
+				msg.Text = "```" + handleWatchlistCommand(subscriber) + "```"
+			case "alert":
+				msg.Text = "```" + handleAlertCommand(subscriber, update.Message.CommandArguments()) + "```"
+			case "alerts":
+				msg.Text = "```" + handleAlertsCommand(subscriber, update.Message.CommandArguments()) + "```"
+			case "chart":
+				msg.Text = escapeText(handleChartCommand(ctx, bot, subscriber, update.Message.CommandArguments()))
+			case "compare":
+				msg.Text = escapeText(handleCompareCommand(ctx, bot, subscriber, update.Message.CommandArguments()))
+			case "email":
+				msg.Text = escapeText(setSubscriberEmail(subscriber, update.Message.CommandArguments()))
+			case "quote":
+				msg.Text = escapeText(handleQuoteCommand(subscriber, update.Message.CommandArguments()))
+			case "settings":
+				msg.Text = "```" + handleSettingsCommand(subscriber, update.Message.CommandArguments()) + "```"
+			case "outbox":
+				msg.Text = "```" + handleOutboxCommand(subscriber) + "```"
+			case "subscribers":
+				msg.Text = "```" + handleSubscribersCommand(subscriber) + "```"
+			case "ratelimit":
+				msg.Text = "```" + handleRateLimitCommand(subscriber) + "```"
+			case "jobs":
+				msg.Text = "```" + handleJobsCommand(subscriber) + "```"
 			default:
 				msg.Text = "I don't know that command"
 			}
+		} else {
+			handleTextMessage(ctx, bot, update.Message.Text, subscriber, &msg)
 		}
 
-		switch update.Message.Text {
-		case "Btc ❤️":
-			msg.Text = ""
-			sendCoinGraph(subscriber.TelegramId, "BTC", "")
-		case "Btc ❤️ 10m":
-			msg.Text = ""
-			sendCoinGraph(subscriber.TelegramId, "BTC", "10m")
-		case "Btc ❤️ 1H":
-			msg.Text = ""
-			sendCoinGraph(subscriber.TelegramId, "BTC", "1H")
-		case "Есь че? 😘":
-			msg.Text = "```" + getNotificationText() + "```"
-		default:
-			rate, err := getActualExchangeRate(update.Message.Text)
-			if err == nil {
-				msg.Text = "```" + rate + "```"
-			} else {
-				msg.Text = err.Error()
-			}
-
-			if rate != "" {
-				coin := strings.ToUpper(strings.TrimSpace(update.Message.Text))
-				coin = strings.Replace(coin, "?", "", 100)
-				sendCoinGraph(subscriber.TelegramId, coin, "1H")
-			}
+		if msg.Text == "" {
+			continue
 		}
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := sendTelegram(ctx, bot, msg.ChatID, msg); err != nil {
 			log.Warnf("can't send bot message telegramBot: %v", err)
 		}
 	}
 }
 
+func handleTextMessage(ctx context.Context, bot *tgbotapi.BotAPI, text string, subscriber *Subscriber, msg *tgbotapi.MessageConfig) {
+	quote := subscriber.getQuote()
+
+	switch text {
+	case "Btc ❤️":
+		msg.Text = ""
+		sendCoinGraph(ctx, bot, subscriber.TelegramId, "BTC", quote, "", ChartTypeLine)
+	case "Btc ❤️ 10m":
+		msg.Text = ""
+		sendCoinGraph(ctx, bot, subscriber.TelegramId, "BTC", quote, "10m", ChartTypeLine)
+	case "Btc ❤️ 1H":
+		msg.Text = ""
+		sendCoinGraph(ctx, bot, subscriber.TelegramId, "BTC", quote, "1H", ChartTypeLine)
+	case "Есь че? 😘":
+		thresholds, err := subscriber.getThresholds()
+		if err != nil {
+			log.Warnf("can't get subscriber thresholds: %v", err)
+		}
+		msg.Text = "```" + getNotificationText(thresholds, quote) + "```"
+	default:
+		rate, err := getActualExchangeRate(text, quote)
+		if err == nil {
+			msg.Text = "```" + rate + "```"
+		} else {
+			msg.Text = err.Error()
+		}
+
+		if rate != "" {
+			coin := strings.ToUpper(strings.TrimSpace(text))
+			coin = strings.Replace(coin, "?", "", 100)
+			sendCoinGraph(ctx, bot, subscriber.TelegramId, coin, quote, "1H", ChartTypeLine)
+		}
+	}
+}
+
+func setSubscriberEmail(subscriber *Subscriber, argument string) string {
+	argument = strings.TrimSpace(argument)
+
+	if argument == "" {
+		if subscriber.Email == "" {
+			return "Usage: /email you@example.com or /email off"
+		}
+		return "Notifications are also sent to " + subscriber.Email
+	}
+
+	email := ""
+	if argument != "off" {
+		address, err := mail.ParseAddress(argument)
+		if err != nil {
+			return "Invalid email: " + argument
+		}
+		email = address.Address
+	}
+
+	if err := subscriber.updateEmail(email); err != nil {
+		log.Warnf("can't update subscriber email: %v", err)
+		return "Возникла ошибка №435/3"
+	}
+
+	if email == "" {
+		return "Email notifications are off"
+	}
+
+	return "Notifications will also be sent to " + email
+}
+
 func dbInit() {
+	db := getConfig().Db
 	dbConnect = *pg.Connect(&pg.Options{
-		Addr:     appConfig.Db.Host + ":" + strconv.Itoa(appConfig.Db.Port),
-		User:     appConfig.Db.User,
-		Password: appConfig.Db.Pass,
-		Database: appConfig.Db.Dbname,
+		Addr:     db.Host + ":" + strconv.Itoa(db.Port),
+		User:     db.User,
+		Password: db.Pass,
+		Database: db.Dbname,
 	})
 
 	ctx := context.Background()
@@ -192,119 +304,19 @@ func dbInit() {
 	}
 }
 
-func getPercentCoins(coins *[]PercentCoinShort) (err error) {
-	_, err = dbConnect.Query(coins, `
+func getNotificationText(thresholds Thresholds, quote string) string {
 
-WITH coin_pairs_24_hours AS (
-    SELECT k.coin_pair_id, c.id as coin_id, c.code, k.open, k.close, k.high, k.low, k.open_time, k.close_time, c.rank
-    FROM klines AS k
-             INNER JOIN coins_pairs AS cp ON cp.id = k.coin_pair_id
-             INNER JOIN coins AS c ON c.id = cp.coin_id
-    WHERE cp.couple = 'BUSD' AND c.is_enabled = 1 AND cp.is_enabled = 1 AND k.open_time >= NOW() - INTERVAL '1 DAY'
-    ORDER BY c.rank
-)
-
-SELECT *
-FROM (
-         SELECT t.*,
-                ROUND(CAST((COALESCE(t.minute10, 0) + COALESCE(t.hour, 0) +
-                            COALESCE(t.hour4, 0) + COALESCE(t.hour12, 0) +
-                            COALESCE(t.hour24, 0)) AS NUMERIC), 3) AS percent_sum
-         FROM (
-
-                           SELECT DISTINCT ON (t.coin_id) t.coin_id,
-                                                          t.code,
-                                                          t.rank,
-                                                          CAlC_PERCENT(MIN(COALESCE(minute10.first_open, 0)), MIN(COALESCE(minute10.last_close, 0))) AS minute10,
-                                                          CAlC_PERCENT(MIN(COALESCE(hour.first_open, 0)), MIN(COALESCE(hour.last_close, 0)))         AS hour,
-                                                          CAlC_PERCENT(MIN(COALESCE(hour4.first_open, 0)), MIN(COALESCE(hour4.last_close, 0)))       AS hour4,
-                                                          CAlC_PERCENT(MIN(COALESCE(hour12.first_open, 0)), MIN(COALESCE(hour12.last_close, 0)))     AS hour12,
-                                                          CAlC_PERCENT(MIN(COALESCE(hour24.first_open, 0)), MIN(COALESCE(hour24.last_close, 0)))     AS hour24
-
-                           FROM coin_pairs_24_hours AS t
-                                    LEFT JOIN (
-                               SELECT t.coin_pair_id,
-                                      MIN(t.open)                                       AS min_open,
-                                      MAX(t.close)                                      AS max_close,
-                                      (array_agg(t.open order by t.open_time asc))[1]   as first_open,
-                                      (array_agg(t.close order by t.open_time desc))[1] as last_close
-                               FROM coin_pairs_24_hours AS t
-                               WHERE t.open_time >= date_round_down(NOW() - interval '10 MINUTE', '10 MINUTE')
-                                  OR (t.open_time <= date_round_down(NOW() - interval '10 MINUTE', '10 MINUTE') AND
-                                      t.close_time >= NOW())
-                               GROUP BY t.coin_pair_id
-                           ) as minute10 ON t.coin_pair_id = minute10.coin_pair_id
-                                    LEFT JOIN (
-                               SELECT t.coin_pair_id,
-                                      MIN(t.open)                                       AS min_open,
-                                      MAX(t.close)                                      AS max_close,
-                                      (array_agg(t.open order by t.open_time asc))[1]   as first_open,
-                                      (array_agg(t.close order by t.open_time desc))[1] as last_close
-                               FROM coin_pairs_24_hours AS t
-                               WHERE t.open_time >= date_round_down(NOW() - interval '1 HOUR', '1 HOUR')
-                               GROUP BY t.coin_pair_id
-                           ) as hour ON t.coin_pair_id = hour.coin_pair_id
-                                    LEFT JOIN (
-                               SELECT t.coin_pair_id,
-                                      MIN(t.open)                                       AS min_open,
-                                      MAX(t.close)                                      AS max_close,
-                                      (array_agg(t.open order by t.open_time asc))[1]   as first_open,
-                                      (array_agg(t.close order by t.open_time desc))[1] as last_close
-                               FROM coin_pairs_24_hours AS t
-                               WHERE t.open_time >= date_round_down(NOW() - interval '4 HOUR', '1 HOUR')
-                               GROUP BY t.coin_pair_id
-                           ) as hour4 ON t.coin_pair_id = hour4.coin_pair_id
-                                    LEFT JOIN (
-                               SELECT t.coin_pair_id,
-                                      MIN(t.open)                                       AS min_open,
-                                      MAX(t.close)                                      AS max_close,
-                                      (array_agg(t.open order by t.open_time asc))[1]   as first_open,
-                                      (array_agg(t.close order by t.open_time desc))[1] as last_close
-                               FROM coin_pairs_24_hours AS t
-                               WHERE t.open_time >= date_round_down(NOW() - interval '12 HOUR', '1 HOUR')
-                               GROUP BY t.coin_pair_id
-                           ) as hour12 ON t.coin_pair_id = hour12.coin_pair_id
-                                    LEFT JOIN (
-                               SELECT t.coin_pair_id,
-                                      MIN(t.open)                                       AS min_open,
-                                      MAX(t.close)                                      AS max_close,
-                                      (array_agg(t.open order by t.open_time asc))[1]   as first_open,
-                                      (array_agg(t.close order by t.open_time desc))[1] as last_close
-                               FROM coin_pairs_24_hours AS t
-                               GROUP BY t.coin_pair_id
-                           ) AS hour24 ON t.coin_pair_id = hour24.coin_pair_id
-                           GROUP BY t.coin_id, t.code, t.rank
-                           ORDER BY t.coin_id
-                           LIMIT 45
-                       ) AS t
-                        WHERE (
-                                (t.minute10 >= 2 OR t.minute10 <= -2)
-                                OR (t.hour >= 3 OR t.hour <= -3)
-                                OR (t.hour4 >= 4 OR t.hour4 <= -4)
-                                OR (t.hour12 >= 8 OR t.hour12 <= -8)
-                                OR (t.hour24 >= 10 OR t.hour24 <= -10))
-     ) AS t
-WHERE percent_sum >= 2
-ORDER BY percent_sum DESC;
-`)
+	coins, err := marketData.GetPercentCoins(quote)
 
 	if err != nil {
-		log.Error("can't get percent pairs: %v", err)
-		return err
+		log.Errorf("can't get percent pairs: %v", err)
+		return "Возникла ошибка №435/1"
 	}
 
-	return nil
+	return formatPercentCoins(filterPercentCoins(coins, thresholds), "Coins, "+quote+".")
 }
 
-func getNotificationText() string {
-
-	var coins []PercentCoinShort
-	err := getPercentCoins(&coins)
-
-	if err != nil {
-		return "Возникла ошибка №435/1"
-	}
-
+func formatPercentCoins(coins []PercentCoinShort, caption string) string {
 	countCoins := len(coins)
 
 	if countCoins == 0 {
@@ -314,7 +326,7 @@ func getNotificationText() string {
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
 	table.SetHeader([]string{"Name", "10m", "1h", "4h", "12h", "24h"})
-	table.SetCaption(true, "Coins.")
+	table.SetCaption(true, caption)
 
 	for _, coin := range coins {
 		table.Append([]string{
@@ -332,133 +344,122 @@ func getNotificationText() string {
 	return tableString.String()
 }
 
-func sendNotifications() {
-	if sendNotificationsIsWorking == true {
-		return
-	}
-
+func sendNotifications(ctx context.Context) {
 	fmt.Println("Send notifications start work")
 
-	notificationText := getNotificationText()
-
-	if notificationText == "" {
-		fmt.Println("countCoins is zero")
-		sendNotificationsIsWorking = false
-		return
-	}
-
-	sendNotificationsIsWorking = true
-
 	var subscribers []Subscriber
-	err := dbConnect.Model(&subscribers).
+	err := dbConnect.ModelContext(ctx, &subscribers).
 		Where("is_enabled = ?", 1).
 		Select()
 
 	if err != nil {
-		log.Warn("can't get subscribers: %v", err)
-		sendNotificationsIsWorking = false
+		log.Warnf("can't get subscribers: %v", err)
 		return
 	}
 
-	bot, err := tgbotapi.NewBotAPI(appConfig.TelegramBot)
+	thresholds, err := getSubscribersThresholds(subscribers)
 	if err != nil {
-		log.Warn(err)
+		log.Warnf("can't get subscribers thresholds: %v", err)
 		return
 	}
 
+	watchlists, err := getSubscribersWatchlists(subscribers)
+	if err != nil {
+		log.Warnf("can't get subscribers watchlists: %v", err)
+	}
+
+	history, err := loadNotificationHistory(NotificationKindMovers, subscribers)
+	if err != nil {
+		log.Warnf("can't get notifications history: %v", err)
+	}
+
 	defer func() {
 		subscribers = nil
-		bot = nil
 	}()
 
-	bot.Debug = false //!!!!
+	for quote, quoteSubscribers := range groupSubscribersByQuote(subscribers) {
+		if ctx.Err() != nil {
+			return
+		}
+		sendQuoteNotifications(ctx, quote, quoteSubscribers, thresholds, watchlists, history)
+	}
+}
+
+func sendQuoteNotifications(ctx context.Context, quote string, subscribers []*Subscriber, thresholds map[int64]Thresholds, watchlists map[int64][]string, history notificationHistory) {
+	repository := marketData.WithContext(ctx)
 
+	coins, err := repository.GetPercentCoins(quote)
+	if err != nil {
+		log.Errorf("can't get percent pairs: %v", err)
+		return
+	}
+
+	if len(coins) == 0 {
+		fmt.Println("countCoins is zero for " + quote)
+		return
+	}
+
+	var codes []string
 	for _, subscriber := range subscribers {
-		msg := tgbotapi.NewMessage(subscriber.TelegramId, "```"+notificationText+"```")
-		msg.ParseMode = "MarkdownV2"
-		if _, err := bot.Send(msg); err != nil {
-			if strings.Contains(err.Error(), "Forbidden: bot was blocked by the user") { // to const error text
-				err := subscriber.enabledFalse()
-				if err != nil {
-					log.Warnf("Error disable subscriber: %v", err)
-					continue
-				}
-			} else {
-				log.Error(err)
+		for _, code := range watchlists[subscriber.Id] {
+			if !containsString(codes, code) {
+				codes = append(codes, code)
 			}
 		}
+	}
 
-		sendCoinGraph(subscriber.TelegramId, "", "")
+	watchedCoins, err := getWatchedCoins(repository, quote, codes)
+	if err != nil {
+		log.Warnf("can't get watched coins: %v", err)
 	}
 
-	sendNotificationsIsWorking = false
-}
+	graph, err := renderCoinGraph("", quote, "")
+	if err != nil {
+		log.Warnf("can't render coin graph: %v", err)
+	}
 
-func getConsolidationPeriodCoins(coins *[]ConsolidationPeriodCoin) (err error) {
-	_, err = dbConnect.Query(coins, `
-
-WITH coins_last_prices AS (
-    SELECT DISTINCT ON (k.coin_pair_id) k.coin_pair_id, c.id AS coin_id, k.close
-    FROM klines AS k
-             INNER JOIN coins_pairs AS cp ON cp.id = k.coin_pair_id
-             INNER JOIN coins AS c ON c.id = cp.coin_id
-    WHERE cp.couple = 'BUSD'
-      AND c.is_enabled = 1
-      AND cp.is_enabled = 1
-    ORDER BY k.coin_pair_id, k.close_time DESC
-)
+	// the cancellation stops the queries only, the computed broadcast is queued for every subscriber
+	for _, subscriber := range subscribers {
+		var movers []PercentCoinShort
+		var loggedCoins []LoggedCoin
 
-SELECT t.*
-FROM (
-         SELECT c.id AS coin_id, c.code, c.rank, avg(k.open) AS avg_open, avg(k.close) AS avg_close,
-                clp.close AS price, CAlC_PERCENT(avg(k.open),clp.close) AS percent_open,
-                 CAlC_PERCENT(avg(k.close),clp.close) AS percent_close --array_agg(k.open) AS opens,
-         FROM coins AS c
-                  INNER JOIN coins_pairs cp on cp.coin_id = c.id
-                  LEFT JOIN (
-             SELECT date_trunc('day', k.open_time) AS day,
-                    k.coin_pair_id,
-                    AVG(k.open)                    AS open,
-                    AVG(k.close)                   AS close
-             FROM klines AS k
-             WHERE k.open_time >= date_round_down(NOW() - interval '14 DAY', '1 HOUR')
-             GROUP BY day, k.coin_pair_id
-             ORDER BY day DESC
-         ) AS k on cp.id = k.coin_pair_id
-			LEFT JOIN coins_last_prices AS clp ON clp.coin_id = c.id
-         WHERE c.is_enabled = 1 AND cp.is_enabled = 1
-         GROUP BY c.id, c.code, clp.close
-     ) AS t
-WHERE (percent_open >=-3 AND percent_open <= 5) AND (percent_close >=-3 AND percent_close <= 5);
-`)
+		for _, coin := range filterPercentCoins(coins, thresholds[subscriber.Id]) {
+			loggedCoin := newMoverLoggedCoin(coin)
+			if history.isRepeated(subscriber.Id, loggedCoin) {
+				continue
+			}
+			movers = append(movers, coin)
+			loggedCoins = append(loggedCoins, loggedCoin)
+		}
 
-	if err != nil {
-		log.Error("can't get consolidation period: %v", err)
-		return err
-	}
+		notificationText := formatPercentCoins(movers, "Coins, "+quote+".")
+		notificationText += formatWatchlist(watchlists[subscriber.Id], watchedCoins, quote)
+		if notificationText == "" || history.isSent(subscriber.Id, notificationText) {
+			continue
+		}
 
-	return nil
+		notify(subscriber, NotificationKindMovers, notificationText, graph, loggedCoins)
+	}
 }
 
-func getConsolidationPeriodText() string {
+func getConsolidationPeriodText(ctx context.Context, quote string) (string, error) {
 
-	var coins []ConsolidationPeriodCoin
-	err := getConsolidationPeriodCoins(&coins)
+	coins, err := marketData.WithContext(ctx).GetConsolidationPeriodCoins(quote)
 
 	if err != nil {
-		return "Возникла ошибка №435/2"
+		return "", err
 	}
 
 	countCoins := len(coins)
 
 	if countCoins == 0 {
-		return ""
+		return "", nil
 	}
 
 	tableString := &strings.Builder{}
 	table := tablewriter.NewWriter(tableString)
 	table.SetHeader([]string{"Name", "Avg open", "Avg close", "Price"})
-	table.SetCaption(true, "Coins in period consolidation")
+	table.SetCaption(true, "Coins in period consolidation, "+quote)
 
 	for _, coin := range coins {
 		table.Append([]string{
@@ -474,65 +475,58 @@ func getConsolidationPeriodText() string {
 	result := tableString.String()
 
 	if len(result) > 4000 {
-		return result[:4000]
+		return result[:4000], nil
 	}
 
-	return result
+	return result, nil
 }
 
-func sendConsolidationPeriod() {
+func sendConsolidationPeriod(ctx context.Context) {
 
 	fmt.Println("Send consolidationPeriod start work")
 
-	notificationText := getConsolidationPeriodText()
-
-	if notificationText == "" {
-		fmt.Println("countCoins is zero")
-		return
-	}
-
 	var subscribers []Subscriber
-	err := dbConnect.Model(&subscribers).
+	err := dbConnect.ModelContext(ctx, &subscribers).
 		Where("is_enabled = ?", 1).
 		Select()
 
 	if err != nil {
-		log.Warn("can't get subscribers: %v", err)
+		log.Warnf("can't get subscribers: %v", err)
 		return
 	}
 
-	bot, err := tgbotapi.NewBotAPI(appConfig.TelegramBot)
-	if err != nil {
-		log.Warn(err)
-		return
-	}
+	for quote, quoteSubscribers := range groupSubscribersByQuote(subscribers) {
+		if ctx.Err() != nil {
+			return
+		}
 
-	bot.Debug = false //!!!!
+		notificationText, err := getConsolidationPeriodText(ctx, quote)
 
-	for _, subscriber := range subscribers {
-		msg := tgbotapi.NewMessage(subscriber.TelegramId, "```"+notificationText+"```")
-		msg.ParseMode = "MarkdownV2"
-		if _, err := bot.Send(msg); err != nil {
-			if strings.Contains(err.Error(), "Forbidden: bot was blocked by the user") { // to const error text
-				err := subscriber.enabledFalse()
-				if err != nil {
-					log.Warnf("Error disable subscriber: %v", err)
-					continue
-				}
-			} else {
-				log.Error(err)
-				msg := tgbotapi.NewMessage(subscriber.TelegramId, err.Error())
-				bot.Send(msg)
-			}
+		if err != nil && ctx.Err() != nil {
+			log.Warnf("consolidation period for %s is cancelled: %v", quote, err)
+			return
+		}
+
+		if err != nil {
+			// the subscribers get the error number, the error itself stays in the log
+			log.Errorf("can't get consolidation period for %s: %v", quote, err)
+			notificationText = "Возникла ошибка №435/2"
+		}
+
+		if notificationText == "" {
+			fmt.Println("countCoins is zero for " + quote)
+			continue
+		}
+
+		for _, subscriber := range quoteSubscribers {
+			notify(subscriber, NotificationKindConsolidation, notificationText, nil, nil)
 		}
 	}
 }
 
-func getActualExchangeRate(message string) (string, error) {
+func getActualExchangeRate(message string, quote string) (string, error) {
 	message = strings.ToUpper(strings.TrimSpace(message))
 
-	var rate PercentCoin
-
 	if !strings.Contains(message, "?") {
 		return "", errors.New("no correct coin")
 	}
@@ -543,92 +537,15 @@ func getActualExchangeRate(message string) (string, error) {
 		return "", errors.New("no correct coin")
 	}
 
-	res, err := dbConnect.Query(&rate, `
+	rate, err := marketData.GetExchangeRate(coin, quote)
 
-WITH coin_pairs_24_hours AS (
-    SELECT k.coin_pair_id, c.id as coin_id, c.code, k.open, k.close, k.high, k.low, k.close_time, k.open_time, c.rank
-    FROM klines AS k
-             INNER JOIN coins_pairs AS cp ON cp.id = k.coin_pair_id
-             INNER JOIN coins AS c ON c.id = cp.coin_id
-    WHERE cp.couple = 'BUSD'
-      AND c.is_enabled = 1
-      AND cp.is_enabled = 1
-      AND k.open_time >= NOW() - INTERVAL '1 DAY'
-      AND c.code = ?
-)
-
-SELECT DISTINCT ON (t.coin_id) t.coin_id,
-                               t.code,
-                               t.rank,
-                               minute10.percent AS minute10,
-                               hour.percent     AS hour,
-                               hour4.percent    AS hour4,
-                               hour12.percent   AS hour12,
-                               hour24.percent   AS hour24,
-                               minute10.min_open   AS minute10_min_open,
-                               minute10.max_close   AS minute10_max_close,
-                               hour.min_open   AS hour_min_open,
-                               hour.max_close   AS hour_max_close,
-                               hour4.min_open   AS hour4_min_open,
-                               hour4.max_close   AS hour4_max_close,
-                               hour12.min_open   AS hour12_min_open,
-                               hour12.max_close   AS hour12_max_close,
-                               hour24.min_open   AS hour24_min_open,
-                               hour24.max_close   AS hour24_max_close
-FROM coin_pairs_24_hours AS t
-         LEFT JOIN (
-    SELECT t.coin_pair_id,
-           MIN(t.open) AS min_open,
-           MAX(t.close) AS max_close,
-           CAlC_PERCENT(MIN(t.open), MAX(t.close)) AS percent
-    FROM coin_pairs_24_hours AS t
-	WHERE t.open_time >= date_round_down(NOW() - interval '10 MINUTE', '10 MINUTE')
-    GROUP BY t.coin_pair_id
-) as minute10 ON t.coin_pair_id = minute10.coin_pair_id
-         LEFT JOIN (
-    SELECT t.coin_pair_id,
-           MIN(t.open) AS min_open,
-           MAX(t.close) AS max_close,
-           CAlC_PERCENT(MIN(t.open), MAX(t.close)) AS percent
-    FROM coin_pairs_24_hours AS t
-	WHERE t.open_time >= date_round_down(NOW() - interval '1 HOUR', '1 HOUR')
-    GROUP BY t.coin_pair_id
-) as hour ON t.coin_pair_id = hour.coin_pair_id
-         LEFT JOIN (
-    SELECT t.coin_pair_id,
-           MIN(t.open) AS min_open,
-           MAX(t.close) AS max_close,
-           CAlC_PERCENT(MIN(t.open), MAX(t.close)) AS percent
-    FROM coin_pairs_24_hours AS t
-	WHERE t.open_time >= date_round_down(NOW() - interval '4 HOUR', '1 HOUR')
-    GROUP BY t.coin_pair_id
-) as hour4 ON t.coin_pair_id = hour4.coin_pair_id
-         LEFT JOIN (
-    SELECT t.coin_pair_id,
-           MIN(t.open) AS min_open,
-           MAX(t.close) AS max_close,
-           CAlC_PERCENT(MIN(t.open), MAX(t.close)) AS percent
-    FROM coin_pairs_24_hours AS t
-	WHERE t.open_time >= date_round_down(NOW() - interval '12 HOUR', '1 HOUR')
-    GROUP BY t.coin_pair_id
-) as hour12 ON t.coin_pair_id = hour12.coin_pair_id
-         LEFT JOIN (
-    SELECT t.coin_pair_id,
-           MIN(t.open) AS min_open,
-           MAX(t.close) AS max_close,
-           CAlC_PERCENT(MIN(t.open), MAX(t.close)) AS percent
-    FROM coin_pairs_24_hours AS t
-    GROUP BY t.coin_pair_id
-) AS hour24 ON t.coin_pair_id = hour24.coin_pair_id
-`, coin)
-
-	if err != nil {
-		log.Warn("can't get get actual exchange rate: %v", err)
+	if errors.Is(err, errCoinNotFound) {
 		return "", err
 	}
 
-	if res.RowsAffected() == 0 {
-		return "", errors.New("coin not found")
+	if err != nil {
+		log.Warnf("can't get get actual exchange rate: %v", err)
+		return "", err
 	}
 
 	tableString := &strings.Builder{}
@@ -636,7 +553,7 @@ FROM coin_pairs_24_hours AS t
 	table.SetHeader([]string{"Name", "Value"})
 
 	table.Append([]string{"Coin id", IntToStr(int(rate.CoinId))})
-	table.Append([]string{"Coin", rate.Code})
+	table.Append([]string{"Coin", pairName(rate.Code, quote)})
 	table.Append([]string{"Rank", IntToStr(rate.Rank)})
 	table.Append([]string{"10 Minute", FloatToStr(rate.Minute10)})
 	table.Append([]string{"Hour", FloatToStr(rate.Hour)})
@@ -659,59 +576,66 @@ FROM coin_pairs_24_hours AS t
 	return tableString.String(), nil
 }
 
-func getDataForCoinGraph(coin string, typeInterval string) ([]time.Time, []float64, []float64) {
+func getDataForCoinGraph(coin string, quote string, typeInterval string) ([]time.Time, []float64, []float64) {
 	var times []time.Time
 	var closes, volumes []float64
-	var klines []Kline
 
-	if coin == "" {
-		coin = "BTC"
+	klines := getKlinesForCoinGraph(coin, quote, typeInterval)
+
+	for _, kline := range klines {
+		times = append(times, kline.OpenTime)
+		closes = append(closes, kline.Close)
+		volumes = append(volumes, kline.QuoteAssetVolume)
 	}
 
-	var interval string
+	return times, closes, volumes
+}
 
-	switch typeInterval {
-	case "4H":
-	case "":
-		//default:
-		interval = "4 HOUR"
-	case "10m":
-		interval = "10 MINUTE"
-	case "1H":
-		interval = "1 HOUR"
+func getKlinesForCoinGraph(coin string, quote string, typeInterval string) []Kline {
+	if coin == "" {
+		coin = "BTC"
 	}
 
-	res, err := dbConnect.Query(&klines, `
-SELECT klines.*
-FROM klines
-INNER JOIN coins_pairs cp on klines.coin_pair_id = cp.id
-INNER JOIN coins c on c.id = cp.coin_id
-WHERE open_time >= (NOW() - interval '`+interval+`')
- AND c.code = ?
-ORDER BY id ASC;
-`, coin)
+	interval, ok := getChartInterval(typeInterval)
+	if !ok {
+		log.Warnf("unknown chart interval %s", typeInterval)
+		return nil
+	}
 
+	klines, err := marketData.GetKlines(coin, quote, interval)
 	if err != nil {
-		log.Warn("can't get getDataForCoinGraph: %v", err)
-		return nil, nil, nil
+		log.Warnf("can't get getKlinesForCoinGraph: %v", err)
+		return nil
 	}
 
-	if res.RowsAffected() == 0 {
-		return nil, nil, nil
+	return klines
+}
+
+// renderChart returns nil without klines of the coin.
+func renderChart(coin string, quote string, interval string, chartType string) ([]byte, error) {
+	if chartType == ChartTypeCandles {
+		return renderCandlestickGraph(coin, quote, interval)
 	}
+	return renderCoinGraph(coin, quote, interval)
+}
 
-	for _, kline := range klines {
-		times = append(times, kline.OpenTime)
-		closes = append(closes, kline.Close)
-		volumes = append(volumes, kline.QuoteAssetVolume)
+func sendCoinGraph(ctx context.Context, bot *tgbotapi.BotAPI, telegramId int64, coin string, quote string, interval string, chartType string) {
+	graph, err := renderChart(coin, quote, interval, chartType)
+	if err != nil {
+		log.Warnf("can't render coin graph: %v", err)
+		return
 	}
 
-	return times, closes, volumes
+	sendGraph(ctx, bot, telegramId, graph)
 }
 
-func sendCoinGraph(telegramId int64, coin string, interval string) {
+func sendGraph(ctx context.Context, bot *tgbotapi.BotAPI, telegramId int64, graph []byte) {
+	if graph == nil {
+		return
+	}
+
 	var subscribers []Subscriber
-	var query = dbConnect.Model(&subscribers).
+	var query = dbConnect.ModelContext(ctx, &subscribers).
 		Where("is_enabled = ?", 1)
 
 	if telegramId > 0 {
@@ -721,39 +645,38 @@ func sendCoinGraph(telegramId int64, coin string, interval string) {
 	err := query.Select()
 
 	if err != nil {
-		log.Warnf("can't get subscribers by get sendCoinGraph: %v", err)
+		log.Warnf("can't get subscribers by get sendGraph: %v", err)
 		return
 	}
 
-	bot, err := tgbotapi.NewBotAPI(appConfig.TelegramBot)
-	if err != nil {
-		log.Warn(err)
-		return
-	}
+	notifier := newTelegramNotifier(bot)
 
 	defer func() {
 		subscribers = nil
-		bot = nil
 	}()
 
-	bot.Debug = false //!!!!
+	for i := range subscribers {
+		subscriber := &subscribers[i]
+
+		if err := notifier.SendImage(ctx, subscriber, graph); err != nil {
+			handleSendError(notifier, subscriber, err)
+		}
+	}
+}
 
+func renderCoinGraph(coin string, quote string, interval string) ([]byte, error) {
 	if coin == "" {
 		coin = "BTC"
 	}
 
-	xv, yv, _ := getDataForCoinGraph(coin, interval)
+	xv, yv, _ := getDataForCoinGraph(coin, quote, interval)
 
 	if len(xv) == 0 {
-		return
-	}
-
-	if interval == "" {
-		interval = "4H"
+		return nil, nil
 	}
 
 	priceSeries := chart.TimeSeries{
-		Name: coin + " " + interval,
+		Name: pairName(coin, quote) + " " + chartIntervalName(interval),
 		Style: chart.Style{
 			Show:        true,
 			StrokeColor: chart.GetDefaultColor(0),
@@ -782,7 +705,7 @@ func sendCoinGraph(telegramId int64, coin string, interval string) {
 		InnerSeries: priceSeries,
 	}
 
-	min, max := findMinAndMax(yv)
+	min, max := padRange(findMinAndMax(yv))
 
 	graph := chart.Chart{
 		XAxis: chart.XAxis{
@@ -810,27 +733,9 @@ func sendCoinGraph(telegramId int64, coin string, interval string) {
 	}
 
 	buffer := bytes.NewBuffer([]byte{})
-	err = graph.Render(chart.PNG, buffer)
-
-	for _, subscriber := range subscribers {
-
-		photoFileBytes := tgbotapi.FileBytes{
-			Name:  "picture",
-			Bytes: buffer.Bytes(),
-		}
-
-		photo := tgbotapi.NewPhoto(subscriber.TelegramId, photoFileBytes)
-
-		if _, err := bot.Send(photo); err != nil {
-			if strings.Contains(err.Error(), "Forbidden: bot was blocked by the user") { // todo to const error text
-				err := subscriber.enabledFalse()
-				if err != nil {
-					log.Warnf("Error disable subscriber: %v", err)
-					continue
-				}
-			} else {
-				log.Error(err)
-			}
-		}
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return nil, err
 	}
+
+	return buffer.Bytes(), nil
 }
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connectTestDatabase connects to TRADER_TEST_DB, a postgres url of a disposable database.
+// The test is skipped without it.
+func connectTestDatabase(t *testing.T) {
+	dbUrl := os.Getenv("TRADER_TEST_DB")
+	if dbUrl == "" {
+		t.Skip("TRADER_TEST_DB is not set")
+	}
+
+	options, err := pg.ParseURL(dbUrl)
+	if err != nil {
+		t.Fatalf("TRADER_TEST_DB: %v", err)
+	}
+
+	dbConnect = *pg.Connect(options)
+	t.Cleanup(func() {
+		dbConnect.Close()
+	})
+}
+
+// testDatabase connects to the test database, migrates it and empties the notifications tables.
+func testDatabase(t *testing.T) {
+	connectTestDatabase(t)
+
+	if err := migrateUp(&dbConnect); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := dbConnect.Exec(`TRUNCATE notifications_subscribers, notifications_logs, notifications_queue,
+		notifications_subscriber_settings, notifications_watchlist, notifications_price_alerts RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testMarketData(t *testing.T) {
+	repository, err := loadMemoryMarketData("testdata/klines.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marketData = repository
+}
+
+// startTelegramBot runs the bot handler until the test ends.
+func startTelegramBot(t *testing.T, fake *FakeBotAPI) {
+	bot := fake.bot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		telegramBot(ctx, bot)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// DirectQueue delivers the broadcasts at once instead of the outbox, so they run without Postgres.
+type DirectQueue struct {
+	notifiers []Notifier
+	// enqueued is called after each notification
+	enqueued func()
+
+	mutex   sync.Mutex
+	results map[int64]error
+}
+
+func useDirectQueue(t *testing.T, notifiers []Notifier) *DirectQueue {
+	queue := &DirectQueue{notifiers: notifiers, results: make(map[int64]error)}
+
+	previous := notificationQueue
+	notificationQueue = queue
+	t.Cleanup(func() {
+		notificationQueue = previous
+	})
+
+	return queue
+}
+
+func (q *DirectQueue) Enqueue(subscriber *Subscriber, kind string, text string, image []byte, coins []LoggedCoin) error {
+	_, err := deliver(context.Background(), q.notifiers, subscriber, text, image, nil)
+
+	q.mutex.Lock()
+	q.results[subscriber.Id] = err
+	q.mutex.Unlock()
+
+	if q.enqueued != nil {
+		q.enqueued()
+	}
+
+	return nil
+}
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestTelegramBotCommands(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	testDatabase(t)
+	testMarketData(t)
+	startTelegramBot(t, fake)
+
+	fake.pushMessage(100, "/start")
+	fake.pushMessage(100, "/status")
+	fake.pushMessage(100, "/unknown")
+	fake.pushMessage(100, "/thresholds")
+
+	messages := fake.waitRequests(t, "sendMessage", 4, 10*time.Second)
+
+	want := []string{"Привет Test", "I m ok", "I don't know that command", "```"}
+	for i, prefix := range want {
+		if got := messages[i].Params.Get("text"); !strings.HasPrefix(got, prefix) {
+			t.Errorf("reply %d: got %q, want %q...", i, got, prefix)
+		}
+		if got := messages[i].chatId(); got != 100 {
+			t.Errorf("reply %d: got chat %d, want 100", i, got)
+		}
+		if messages[i].Params.Get("reply_markup") == "" {
+			t.Errorf("reply %d: no keyboard", i)
+		}
+	}
+
+	count, err := dbConnect.Model(&Subscriber{}).Where("telegram_id = ?", 100).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d subscribers, want 1", count)
+	}
+
+	fake.pushMessage(100, "/chart BTC")
+
+	photos := fake.waitRequests(t, "sendPhoto", 1, 10*time.Second)
+	if photos[0].chatId() != 100 || !strings.HasPrefix(string(photos[0].Files["photo"]), "\x89PNG") {
+		t.Errorf("got photo for chat %d, %d bytes", photos[0].chatId(), len(photos[0].Files["photo"]))
+	}
+}
+
+func TestBroadcastFanOut(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	testDatabase(t)
+	testMarketData(t)
+
+	chats := []int64{201, 202, 203}
+	for _, chatId := range chats {
+		fake.pushMessage(chatId, "/start")
+	}
+
+	startTelegramBot(t, fake)
+	fake.waitRequests(t, "sendMessage", len(chats), 10*time.Second)
+
+	// the zero thresholds of the test config make every coin a mover
+	fake.fail("sendMessage", 203, FakeError{Code: 403, Description: "Forbidden: bot was blocked by the user"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := startOutbox(ctx, fake.bot(t), 2)
+	defer func() {
+		cancel()
+		workers.Wait()
+	}()
+
+	sendNotifications(ctx)
+
+	waitFor(t, 10*time.Second, func() bool {
+		count, err := dbConnect.Model(&NotificationsLogs{}).
+			Where("status IN (?)", pg.In([]string{NotificationStatusPending, NotificationStatusFailed})).
+			Count()
+		return err == nil && count == 0
+	})
+
+	var logs []NotificationsLogs
+	if err := dbConnect.Model(&logs).Select(); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]int)
+	for _, notification := range logs {
+		statuses[notification.Status]++
+	}
+	if statuses[NotificationStatusSent] != 2 || statuses[NotificationStatusDead] != 1 {
+		t.Errorf("got notifications %v, want 2 sent and 1 dead", statuses)
+	}
+
+	broadcasts := make(map[int64]string)
+	for _, request := range fake.requestsFor("sendMessage") {
+		if strings.HasPrefix(request.Params.Get("text"), "```") {
+			broadcasts[request.chatId()] = request.Params.Get("text")
+		}
+	}
+	for _, chatId := range chats {
+		if !strings.Contains(broadcasts[chatId], "BTC") {
+			t.Errorf("chat %d got %q, want the movers", chatId, broadcasts[chatId])
+		}
+	}
+
+	blocked := &Subscriber{}
+	if err := dbConnect.Model(blocked).Where("telegram_id = ?", 203).Select(); err != nil {
+		t.Fatal(err)
+	}
+	if blocked.IsEnabled != Subscriber_IS_ENABLED_FALSE || blocked.DisabledReason != DisabledReasonBlocked {
+		t.Errorf("got subscriber enabled %d, reason %q, want disabled as blocked", blocked.IsEnabled, blocked.DisabledReason)
+	}
+}
+
+func TestBroadcastFanOutInMemory(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	testMarketData(t)
+	queue := useDirectQueue(t, newNotifiers(fake.bot(t)))
+
+	subscribers := []*Subscriber{{Id: 1, TelegramId: 301}, {Id: 2, TelegramId: 302}, {Id: 3, TelegramId: 303}}
+	fake.fail("sendMessage", 302, FakeError{Code: 502, Description: "Bad Gateway"})
+
+	// the zero thresholds make every coin a mover
+	sendQuoteNotifications(context.Background(), "BUSD", subscribers, nil, nil, make(notificationHistory))
+
+	if len(queue.results) != len(subscribers) {
+		t.Fatalf("got %d notifications, want %d", len(queue.results), len(subscribers))
+	}
+	var sendErr *SendError
+	if !errors.As(queue.results[2], &sendErr) || sendErr.Kind != SendErrorTransient {
+		t.Errorf("chat 302: got %v, want a transient error", queue.results[2])
+	}
+
+	texts := make(map[int64]string)
+	for _, request := range fake.requestsFor("sendMessage") {
+		texts[request.chatId()] = request.Params.Get("text")
+	}
+	photos := make(map[int64]int)
+	for _, request := range fake.requestsFor("sendPhoto") {
+		photos[request.chatId()]++
+	}
+
+	for _, subscriber := range []*Subscriber{subscribers[0], subscribers[2]} {
+		if err := queue.results[subscriber.Id]; err != nil {
+			t.Errorf("chat %d: %v", subscriber.TelegramId, err)
+		}
+		text := texts[subscriber.TelegramId]
+		if !strings.HasPrefix(text, "```") || !strings.Contains(text, "BTC") || !strings.Contains(text, "ETH") {
+			t.Errorf("chat %d got %q, want the movers", subscriber.TelegramId, text)
+		}
+		if photos[subscriber.TelegramId] != 1 {
+			t.Errorf("chat %d got %d charts, want 1", subscriber.TelegramId, photos[subscriber.TelegramId])
+		}
+	}
+	if photos[302] != 0 {
+		t.Errorf("chat 302 got a chart after the failed text")
+	}
+}
+
+func TestBroadcastFinishesOnCancel(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	testMarketData(t)
+	queue := useDirectQueue(t, newNotifiers(fake.bot(t)))
+
+	subscribers := []*Subscriber{{Id: 1, TelegramId: 311}, {Id: 2, TelegramId: 312}, {Id: 3, TelegramId: 313}}
+	// any volume growth is a spike
+	thresholds := make(map[int64]Thresholds)
+	for _, subscriber := range subscribers {
+		thresholds[subscriber.Id] = Thresholds{VolumeSpike: 0.01}
+	}
+
+	// the job is cancelled after the first subscriber is queued
+	for _, broadcast := range []func(ctx context.Context){
+		func(ctx context.Context) {
+			sendQuoteNotifications(ctx, "BUSD", subscribers, thresholds, nil, make(notificationHistory))
+		},
+		func(ctx context.Context) {
+			sendQuoteVolumeSpikes(ctx, "BUSD", subscribers, thresholds, make(notificationHistory))
+		},
+	} {
+		queue.results = make(map[int64]error)
+		ctx, cancel := context.WithCancel(context.Background())
+		queue.enqueued = cancel
+
+		broadcast(ctx)
+
+		if len(queue.results) != len(subscribers) {
+			t.Errorf("got %d notifications, want every subscriber queued after the cancel", len(queue.results))
+		}
+		for id, err := range queue.results {
+			if err != nil {
+				t.Errorf("subscriber %d: %v", id, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/olekukonko/tablewriter"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type SchemaMigration struct {
+	tableName struct{} `pg:"schema_migrations"`
+
+	Version   int       `pg:",pk"`
+	Name      string    `pg:",name"`
+	AppliedAt time.Time `pg:",applied_at"`
+}
+
+// loadMigrations reads migrations/<version>_<name>.<up|down>.sql ordered by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		parts := strings.Split(strings.TrimSuffix(fileName, ".sql"), ".")
+		separator := strings.Index(parts[0], "_")
+
+		if len(parts) != 2 || separator < 1 {
+			return nil, fmt.Errorf("bad migration file name %s", fileName)
+		}
+
+		version, err := strconv.Atoi(parts[0][:separator])
+		if err != nil {
+			return nil, fmt.Errorf("bad migration version in %s: %v", fileName, err)
+		}
+
+		body, err := fs.ReadFile(migrationsFS, "migrations/"+fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		item, ok := byVersion[version]
+		if !ok {
+			item = &migration{Version: version, Name: parts[0][separator+1:]}
+			byVersion[version] = item
+		}
+
+		switch parts[1] {
+		case "up":
+			item.Up = string(body)
+		case "down":
+			item.Down = string(body)
+		default:
+			return nil, fmt.Errorf("bad migration direction in %s", fileName)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, item := range byVersion {
+		if item.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", item.Version)
+		}
+		migrations = append(migrations, *item)
+	}
+
+	sort.Slice(migrations, func(a, b int) bool {
+		return migrations[a].Version < migrations[b].Version
+	})
+
+	return migrations, nil
+}
+
+func getAppliedMigrations(db *pg.DB) (map[int]SchemaMigration, error) {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    INTEGER PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+)`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err := db.Model(&rows).Select(); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return applied, nil
+}
+
+func migrateUp(db *pg.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range migrations {
+		if _, ok := applied[item.Version]; ok {
+			continue
+		}
+
+		err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			if _, err := tx.Exec(item.Up); err != nil {
+				return err
+			}
+
+			_, err := tx.Model(&SchemaMigration{
+				Version:   item.Version,
+				Name:      item.Name,
+				AppliedAt: time.Now(),
+			}).Insert()
+
+			return err
+		})
+
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %v", item.Version, item.Name, err)
+		}
+
+		log.Infof("migration %d_%s applied", item.Version, item.Name)
+	}
+
+	return nil
+}
+
+// migrateDown reverts the last applied migration.
+func migrateDown(db *pg.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		item := migrations[i]
+
+		if _, ok := applied[item.Version]; !ok {
+			continue
+		}
+
+		if item.Down == "" {
+			return fmt.Errorf("migration %d_%s has no down file", item.Version, item.Name)
+		}
+
+		err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			if _, err := tx.Exec(item.Down); err != nil {
+				return err
+			}
+
+			_, err := tx.Model(&SchemaMigration{Version: item.Version}).WherePK().Delete()
+
+			return err
+		})
+
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %v", item.Version, item.Name, err)
+		}
+
+		log.Infof("migration %d_%s reverted", item.Version, item.Name)
+
+		return nil
+	}
+
+	return errors.New("no applied migrations")
+}
+
+func migrateStatus(db *pg.DB) (string, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return "", err
+	}
+
+	applied, err := getAppliedMigrations(db)
+	if err != nil {
+		return "", err
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Version", "Name", "Applied"})
+
+	for _, item := range migrations {
+		appliedAt := "pending"
+		if row, ok := applied[item.Version]; ok {
+			appliedAt = row.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		table.Append([]string{IntToStr(item.Version), item.Name, appliedAt})
+	}
+
+	table.Render()
+
+	return tableString.String(), nil
+}
+
+func runMigrateCommand(db *pg.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(db)
+	case "down":
+		return migrateDown(db)
+	case "status":
+		status, err := migrateStatus(db)
+		if err != nil {
+			return err
+		}
+		fmt.Print(status)
+		return nil
+	}
+
+	return errors.New("usage: migrate up|down|status")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"os"
+	"testing"
+)
+
+// TestMigrateBaselineSchema migrates a database created before the migrations, reverts everything and
+// migrates it again. It recreates the public schema of the test database.
+func TestMigrateBaselineSchema(t *testing.T) {
+	connectTestDatabase(t)
+
+	dump, err := os.ReadFile("testdata/baseline_schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dbConnect.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbConnect.Exec(string(dump)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateUp(&dbConnect); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old notification is kept with the new columns
+	var logs []NotificationsLogs
+	if err := dbConnect.Model(&logs).Select(); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Notification != "BTC 5%" || logs[0].Status != NotificationStatusSent {
+		t.Errorf("got logs %+v", logs)
+	}
+
+	// /start of the old subscriber relies on the unique telegram_id
+	subscriber, err := (&Subscriber{}).addNew(&tgbotapi.Chat{ID: 300, FirstName: "Old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscriber.Id != 1 {
+		t.Errorf("got subscriber %d, want the old one", subscriber.Id)
+	}
+	if err := dbConnect.Model(subscriber).WherePK().Select(); err != nil {
+		t.Fatal(err)
+	}
+	if subscriber.Quote != "BUSD" {
+		t.Errorf("got quote %q, want BUSD backfilled", subscriber.Quote)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range migrations {
+		if err := migrateDown(&dbConnect); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the loader tables and functions stay
+	var count int
+	if _, err := dbConnect.QueryOne(pg.Scan(&count), `SELECT COUNT(*) FROM coins_pairs WHERE couple = 'BUSD'`); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d coins pairs, want the loader data kept", count)
+	}
+	var percent float64
+	if _, err := dbConnect.QueryOne(pg.Scan(&percent), `SELECT CAlC_PERCENT(100, 110)`); err != nil || percent != 10 {
+		t.Errorf("got percent %v: %v, want the loader function kept", percent, err)
+	}
+
+	if err := migrateUp(&dbConnect); err != nil {
+		t.Fatal(err)
+	}
+}
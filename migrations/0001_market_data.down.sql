@@ -0,0 +1,2 @@
+-- klines, coins_pairs and coins belong to the klines loader, the up migration only creates them on an empty
+-- database, so reverting it keeps them.
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS coins
+(
+    id         BIGSERIAL PRIMARY KEY,
+    code       VARCHAR(32) NOT NULL UNIQUE,
+    rank       INTEGER     NOT NULL DEFAULT 0,
+    is_enabled SMALLINT    NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS coins_pairs
+(
+    id         BIGSERIAL PRIMARY KEY,
+    coin_id    BIGINT      NOT NULL REFERENCES coins (id) ON DELETE CASCADE,
+    couple     VARCHAR(32) NOT NULL,
+    is_enabled SMALLINT    NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ,
+    UNIQUE (coin_id, couple)
+);
+
+CREATE TABLE IF NOT EXISTS klines
+(
+    id                           BIGSERIAL PRIMARY KEY,
+    coin_pair_id                 BIGINT           NOT NULL REFERENCES coins_pairs (id) ON DELETE CASCADE,
+    open_time                    TIMESTAMPTZ      NOT NULL,
+    close_time                   TIMESTAMPTZ      NOT NULL,
+    open                         DOUBLE PRECISION NOT NULL,
+    high                         DOUBLE PRECISION NOT NULL,
+    low                          DOUBLE PRECISION NOT NULL,
+    close                        DOUBLE PRECISION NOT NULL,
+    volume                       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    quote_asset_volume           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trade_num                    BIGINT           NOT NULL DEFAULT 0,
+    taker_buy_base_asset_volume  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    taker_buy_quote_asset_volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ratio_open_close             DOUBLE PRECISION,
+    ratio_high_low               DOUBLE PRECISION,
+    UNIQUE (coin_pair_id, open_time)
+);
+
+CREATE INDEX IF NOT EXISTS klines_open_time_index ON klines (open_time);
@@ -0,0 +1 @@
+-- CAlC_PERCENT and date_round_down are used by the klines loader as well, reverting keeps them.
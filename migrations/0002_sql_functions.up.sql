@@ -0,0 +1,15 @@
+CREATE OR REPLACE FUNCTION CAlC_PERCENT(open_price DOUBLE PRECISION, close_price DOUBLE PRECISION)
+    RETURNS DOUBLE PRECISION AS
+$$
+SELECT CASE
+           WHEN open_price IS NULL OR open_price = 0 THEN 0
+           ELSE (close_price - open_price) / open_price * 100
+           END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION date_round_down(base_date TIMESTAMPTZ, round_interval INTERVAL)
+    RETURNS TIMESTAMPTZ AS
+$$
+SELECT to_timestamp(floor(extract(EPOCH FROM base_date) / extract(EPOCH FROM round_interval)) *
+                    extract(EPOCH FROM round_interval))
+$$ LANGUAGE SQL STABLE;
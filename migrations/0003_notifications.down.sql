@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS notifications_price_alerts;
+DROP TABLE IF EXISTS notifications_watchlist;
+DROP TABLE IF EXISTS notifications_subscriber_settings;
+DROP TABLE IF EXISTS notifications_logs;
+DROP TABLE IF EXISTS notifications_subscribers;
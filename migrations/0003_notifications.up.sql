@@ -0,0 +1,92 @@
+CREATE TABLE IF NOT EXISTS notifications_subscribers
+(
+    id                  BIGSERIAL PRIMARY KEY,
+    is_enabled          SMALLINT    NOT NULL DEFAULT 1,
+    telegram_id         BIGINT      NOT NULL,
+    telegram_first_name VARCHAR(255),
+    telegram_last_name  VARCHAR(255),
+    telegram_username   VARCHAR(255),
+    email               VARCHAR(255),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS notifications_logs
+(
+    id            BIGSERIAL PRIMARY KEY,
+    subscriber_id BIGINT      NOT NULL
+        CONSTRAINT notifications_logs_subscriber_id_foreign REFERENCES notifications_subscribers (id) ON DELETE CASCADE,
+    notification  TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ
+);
+
+-- the tables above may come from a database older than the migrations, so the new columns are added separately
+ALTER TABLE notifications_logs
+    ADD COLUMN IF NOT EXISTS kind VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(40),
+    ADD COLUMN IF NOT EXISTS coins JSONB;
+
+DO
+$$
+    BEGIN
+        IF NOT EXISTS(SELECT 1
+                      FROM pg_index AS i
+                               INNER JOIN pg_attribute AS a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+                      WHERE i.indrelid = 'notifications_subscribers'::regclass
+                        AND i.indisunique
+                        AND i.indnatts = 1
+                        AND i.indpred IS NULL
+                        AND a.attname = 'telegram_id') THEN
+            ALTER TABLE notifications_subscribers
+                ADD CONSTRAINT notifications_subscribers_telegram_id_key UNIQUE (telegram_id);
+        END IF;
+    END
+$$;
+
+CREATE INDEX IF NOT EXISTS notifications_logs_subscriber_id_kind_created_at_index
+    ON notifications_logs (subscriber_id, kind, created_at);
+
+CREATE TABLE IF NOT EXISTS notifications_subscriber_settings
+(
+    id            BIGSERIAL PRIMARY KEY,
+    subscriber_id BIGINT           NOT NULL UNIQUE
+        CONSTRAINT notifications_subscriber_settings_subscriber_id_foreign REFERENCES notifications_subscribers (id) ON DELETE CASCADE,
+    minute10      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hour          DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hour4         DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hour12        DOUBLE PRECISION NOT NULL DEFAULT 0,
+    hour24        DOUBLE PRECISION NOT NULL DEFAULT 0,
+    percent_sum   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    volume_spike  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS notifications_watchlist
+(
+    id            BIGSERIAL PRIMARY KEY,
+    subscriber_id BIGINT      NOT NULL
+        CONSTRAINT notifications_watchlist_subscriber_id_foreign REFERENCES notifications_subscribers (id) ON DELETE CASCADE,
+    code          VARCHAR(32) NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (subscriber_id, code)
+);
+
+CREATE TABLE IF NOT EXISTS notifications_price_alerts
+(
+    id              BIGSERIAL PRIMARY KEY,
+    subscriber_id   BIGINT           NOT NULL
+        CONSTRAINT notifications_price_alerts_subscriber_id_foreign REFERENCES notifications_subscribers (id) ON DELETE CASCADE,
+    code            VARCHAR(32)      NOT NULL,
+    direction       VARCHAR(8)       NOT NULL,
+    price           DOUBLE PRECISION NOT NULL,
+    is_active       SMALLINT         NOT NULL DEFAULT 1,
+    is_rearm        SMALLINT         NOT NULL DEFAULT 0,
+    triggered_price DOUBLE PRECISION,
+    triggered_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ      NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS notifications_price_alerts_is_active_index ON notifications_price_alerts (is_active);
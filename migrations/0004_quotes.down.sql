@@ -0,0 +1,5 @@
+ALTER TABLE notifications_price_alerts
+    DROP COLUMN IF EXISTS quote;
+
+ALTER TABLE notifications_subscribers
+    DROP COLUMN IF EXISTS quote;
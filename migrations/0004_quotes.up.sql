@@ -0,0 +1,5 @@
+ALTER TABLE notifications_subscribers
+    ADD COLUMN IF NOT EXISTS quote VARCHAR(32);
+
+ALTER TABLE notifications_price_alerts
+    ADD COLUMN IF NOT EXISTS quote VARCHAR(32);
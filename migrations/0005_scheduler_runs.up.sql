@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS scheduler_runs
+(
+    job         VARCHAR(64) PRIMARY KEY,
+    last_run_at TIMESTAMPTZ NOT NULL
+);
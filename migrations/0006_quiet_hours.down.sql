@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS notifications_queue;
+
+ALTER TABLE notifications_subscribers
+    DROP COLUMN IF EXISTS quiet_to,
+    DROP COLUMN IF EXISTS quiet_from,
+    DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,17 @@
+ALTER TABLE notifications_subscribers
+    ADD COLUMN IF NOT EXISTS timezone VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS quiet_from SMALLINT,
+    ADD COLUMN IF NOT EXISTS quiet_to SMALLINT;
+
+CREATE TABLE IF NOT EXISTS notifications_queue
+(
+    id            BIGSERIAL PRIMARY KEY,
+    subscriber_id BIGINT      NOT NULL
+        CONSTRAINT notifications_queue_subscriber_id_foreign REFERENCES notifications_subscribers (id) ON DELETE CASCADE,
+    kind          VARCHAR(32) NOT NULL,
+    notification  TEXT        NOT NULL,
+    coins         JSONB,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS notifications_queue_subscriber_id_index ON notifications_queue (subscriber_id);
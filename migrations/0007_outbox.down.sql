@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS notifications_logs_outbox_index;
+
+ALTER TABLE notifications_logs
+    DROP COLUMN IF EXISTS sent_at,
+    DROP COLUMN IF EXISTS image,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS next_attempt_at,
+    DROP COLUMN IF EXISTS attempts,
+    DROP COLUMN IF EXISTS status;
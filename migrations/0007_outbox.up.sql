@@ -0,0 +1,10 @@
+ALTER TABLE notifications_logs
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'sent',
+    ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS last_error TEXT,
+    ADD COLUMN IF NOT EXISTS image BYTEA,
+    ADD COLUMN IF NOT EXISTS sent_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS notifications_logs_outbox_index
+    ON notifications_logs (next_attempt_at) WHERE status IN ('pending', 'failed');
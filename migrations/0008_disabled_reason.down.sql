@@ -0,0 +1,3 @@
+ALTER TABLE notifications_subscribers
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS disabled_reason;
@@ -0,0 +1,3 @@
+ALTER TABLE notifications_subscribers
+    ADD COLUMN IF NOT EXISTS disabled_reason VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
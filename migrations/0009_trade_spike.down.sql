@@ -0,0 +1,2 @@
+ALTER TABLE notifications_subscriber_settings
+    DROP COLUMN IF EXISTS trade_spike;
@@ -0,0 +1,2 @@
+ALTER TABLE notifications_subscriber_settings
+    ADD COLUMN IF NOT EXISTS trade_spike DOUBLE PRECISION NOT NULL DEFAULT 2;
@@ -0,0 +1,7 @@
+ALTER TABLE notifications_price_alerts
+    ALTER COLUMN quote DROP NOT NULL,
+    ALTER COLUMN quote DROP DEFAULT;
+
+ALTER TABLE notifications_subscribers
+    ALTER COLUMN quote DROP NOT NULL,
+    ALTER COLUMN quote DROP DEFAULT;
@@ -0,0 +1,16 @@
+-- the subscribers and alerts from before the quotes traded against BUSD only
+UPDATE notifications_subscribers
+SET quote = 'BUSD'
+WHERE quote IS NULL;
+
+UPDATE notifications_price_alerts
+SET quote = 'BUSD'
+WHERE quote IS NULL;
+
+ALTER TABLE notifications_subscribers
+    ALTER COLUMN quote SET DEFAULT 'BUSD',
+    ALTER COLUMN quote SET NOT NULL;
+
+ALTER TABLE notifications_price_alerts
+    ALTER COLUMN quote SET DEFAULT 'BUSD',
+    ALTER COLUMN quote SET NOT NULL;
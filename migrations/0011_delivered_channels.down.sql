@@ -0,0 +1,2 @@
+ALTER TABLE notifications_logs
+    DROP COLUMN IF EXISTS delivered_channels;
@@ -0,0 +1,2 @@
+ALTER TABLE notifications_logs
+    ADD COLUMN IF NOT EXISTS delivered_channels TEXT[];
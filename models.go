@@ -20,6 +20,12 @@ type Subscriber struct {
 	TelegramLastName  string `pg:",telegram_last_name"`
 	TelegramUsername  string `pg:",telegram_username"`
 	Email             string
+	Quote             string    `pg:",quote"`
+	Timezone          string    `pg:",timezone"`
+	QuietFrom         *int      `pg:",quiet_from"`
+	QuietTo           *int      `pg:",quiet_to"`
+	DisabledReason    string    `pg:",disabled_reason"`
+	DisabledAt        time.Time `pg:",disabled_at"`
 	CreatedAt         time.Time `pg:",created_at"`
 	UpdatedAt         time.Time `pg:",updated_at"`
 }
@@ -31,6 +37,7 @@ func (a *Subscriber) addNew(data *tgbotapi.Chat) (acc *Subscriber, err error) {
 		TelegramFirstName: data.FirstName,
 		TelegramLastName:  data.LastName,
 		TelegramUsername:  data.UserName,
+		Quote:             defaultQuote(),
 		CreatedAt:         time.Now(),
 	}
 
@@ -38,16 +45,23 @@ func (a *Subscriber) addNew(data *tgbotapi.Chat) (acc *Subscriber, err error) {
 		Where("telegram_id = ?telegram_id").
 		OnConflict("(telegram_id) DO UPDATE").
 		Set("is_enabled = ?is_enabled").
+		Set("disabled_reason = NULL").
+		Set("disabled_at = NULL").
+		Returning("*").
 		Insert()
 
 	return newAccount, err
 }
 
-func (s *Subscriber) enabledFalse() (err error) {
+func (s *Subscriber) disable(reason string) (err error) {
 	s.IsEnabled = Subscriber_IS_ENABLED_FALSE
+	s.DisabledReason = reason
+	s.DisabledAt = time.Now()
 	s.UpdatedAt = time.Now()
 	_, err = dbConnect.Model(s).
 		Set("is_enabled = ?is_enabled").
+		Set("disabled_reason = ?disabled_reason").
+		Set("disabled_at = ?disabled_at").
 		Set("updated_at = ?updated_at").
 		Where("id = ?id").
 		Update()
@@ -55,14 +69,146 @@ func (s *Subscriber) enabledFalse() (err error) {
 	return err
 }
 
+// migrateChat moves the subscriber to the supergroup its group chat was upgraded to.
+func (s *Subscriber) migrateChat(chatId int64) (err error) {
+	s.TelegramId = chatId
+	s.UpdatedAt = time.Now()
+	_, err = dbConnect.Model(s).
+		Set("telegram_id = ?telegram_id").
+		Set("updated_at = ?updated_at").
+		Where("id = ?id").
+		Update()
+
+	return err
+}
+
+func (s *Subscriber) updateEmail(email string) (err error) {
+	s.Email = email
+	s.UpdatedAt = time.Now()
+	_, err = dbConnect.Model(s).
+		Set("email = ?email").
+		Set("updated_at = ?updated_at").
+		Where("id = ?id").
+		Update()
+
+	return err
+}
+
+const (
+	NotificationKindMovers        = "movers"
+	NotificationKindVolume        = "volume"
+	NotificationKindPriceAlert    = "price_alert"
+	NotificationKindConsolidation = "consolidation"
+	NotificationKindQuietSummary  = "quiet_summary"
+)
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	// NotificationStatusFailed is retried at NextAttemptAt
+	NotificationStatusFailed = "failed"
+	// NotificationStatusDead is not retried anymore
+	NotificationStatusDead = "dead"
+)
+
+// NotificationsLogs is also the outbox, a notification is queued as pending and sent by the outbox workers.
 type NotificationsLogs struct {
 	tableName struct{} `pg:"notifications_logs"`
 
+	Id            int64
+	SubscriberId  int64 `pg:",subscriber_id,foreign:notifications_logs_subscriber_id_foreign"`
+	Notification  string
+	Kind          string       `pg:",kind"`
+	Fingerprint   string       `pg:",fingerprint"`
+	Coins         []LoggedCoin `pg:",coins,type:jsonb"`
+	Image         []byte       `pg:",image"`
+	Status        string       `pg:",status"`
+	Attempts      int          `pg:",attempts,use_zero"`
+	NextAttemptAt time.Time    `pg:",next_attempt_at"`
+	LastError     string       `pg:",last_error"`
+	SentAt        time.Time    `pg:",sent_at"`
+	CreatedAt     time.Time    `pg:",created_at"`
+	UpdatedAt     time.Time    `pg:",updated_at"`
+	// DeliveredChannels are not sent again on retry
+	DeliveredChannels []string `pg:",delivered_channels,array"`
+}
+
+// QueuedNotification is a broadcast held back during the subscriber's quiet hours or a shutdown.
+type QueuedNotification struct {
+	tableName struct{} `pg:"notifications_queue"`
+
 	Id           int64
-	SubscriberId int64 `pg:",subscriber_id,foreign:notifications_logs_subscriber_id_foreign"`
+	SubscriberId int64  `pg:",subscriber_id,foreign:notifications_queue_subscriber_id_foreign"`
+	Kind         string `pg:",kind"`
 	Notification string
+	Coins        []LoggedCoin `pg:",coins,type:jsonb"`
+	CreatedAt    time.Time    `pg:",created_at"`
+}
+
+type LoggedCoin struct {
+	Code      string  `json:"code"`
+	Direction string  `json:"direction"`
+	Value     float64 `json:"value"`
+}
+
+type Thresholds struct {
+	Minute10   float64 `pg:",minute10,use_zero"`
+	Hour       float64 `pg:",hour,use_zero"`
+	Hour4      float64 `pg:",hour4,use_zero"`
+	Hour12     float64 `pg:",hour12,use_zero"`
+	Hour24     float64 `pg:",hour24,use_zero"`
+	PercentSum float64 `pg:",percent_sum,use_zero"`
+	// VolumeSpike is the minimum recent/baseline quote volume ratio, 0 disables volume spike notifications.
+	VolumeSpike float64 `pg:",volume_spike,use_zero"`
+	// TradeSpike is the minimum recent/baseline trade count ratio of a volume spike, so one large trade isn't a spike.
+	TradeSpike float64 `pg:",trade_spike,use_zero"`
+}
+
+type SubscriberSettings struct {
+	tableName struct{} `pg:"notifications_subscriber_settings"`
+
+	Id           int64
+	SubscriberId int64 `pg:",subscriber_id,foreign:notifications_subscriber_settings_subscriber_id_foreign"`
+	Thresholds
+	CreatedAt time.Time `pg:",created_at"`
+	UpdatedAt time.Time `pg:",updated_at"`
+}
+
+type WatchlistCoin struct {
+	tableName struct{} `pg:"notifications_watchlist"`
+
+	Id           int64
+	SubscriberId int64     `pg:",subscriber_id,foreign:notifications_watchlist_subscriber_id_foreign"`
+	Code         string    `pg:",code"`
 	CreatedAt    time.Time `pg:",created_at"`
-	UpdatedAt    time.Time `pg:",updated_at"`
+}
+
+const (
+	PriceAlert_IS_ACTIVE_TRUE  = 1
+	PriceAlert_IS_ACTIVE_FALSE = 0
+)
+
+type PriceAlert struct {
+	tableName struct{} `pg:"notifications_price_alerts"`
+
+	Id             int64
+	SubscriberId   int64     `pg:",subscriber_id,foreign:notifications_price_alerts_subscriber_id_foreign"`
+	Code           string    `pg:",code"`
+	Quote          string    `pg:",quote"`
+	Direction      string    `pg:",direction"`
+	Price          float64   `pg:",price"`
+	IsActive       int8      `pg:",is_active,use_zero"`
+	IsRearm        int8      `pg:",is_rearm,use_zero"`
+	TriggeredPrice float64   `pg:",triggered_price"`
+	TriggeredAt    time.Time `pg:",triggered_at"`
+	CreatedAt      time.Time `pg:",created_at"`
+	UpdatedAt      time.Time `pg:",updated_at"`
+}
+
+type CoinPrice struct {
+	Code      string
+	Close     float64
+	CloseTime time.Time
 }
 
 type PercentCoin struct {
@@ -110,6 +256,18 @@ type ConsolidationPeriodCoin struct {
 	PercentClose float64
 }
 
+type VolumeSpike struct {
+	CoinPairId          int64
+	Code                string
+	Rank                int
+	QuoteVolume         float64
+	BaselineQuoteVolume float64
+	TradeNum            float64
+	BaselineTradeNum    float64
+	VolumeRatio         float64
+	TradeRatio          float64
+}
+
 type Kline struct {
 	tableName struct{} `pg:"klines"`
 
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTelegramApi = "https://api.telegram.org"
+	// telegramTimeout is longer than the long polling timeout of getUpdates
+	telegramTimeout = 90 * time.Second
+)
+
+// errNotApplicable is returned by a notifier that has no address for the subscriber, it's neither a delivery nor a failure.
+var errNotApplicable = errors.New("no address for the subscriber")
+
+// Notifier delivers broadcast content to a subscriber over a single channel.
+type Notifier interface {
+	// Channel names the channel in the delivered channels of a notification.
+	Channel() string
+	SendText(ctx context.Context, subscriber *Subscriber, text string) error
+	SendImage(ctx context.Context, subscriber *Subscriber, image []byte) error
+	// ClassifyError tells whether err is worth a retry and whether the subscriber can be reached again.
+	ClassifyError(err error) *SendError
+}
+
+// ReportNotifier is implemented by channels that deliver a text and its chart as one message.
+type ReportNotifier interface {
+	SendReport(ctx context.Context, subscriber *Subscriber, text string, image []byte) error
+}
+
+type TelegramNotifier struct {
+	bot *tgbotapi.BotAPI
+}
+
+// newTelegramBot creates the one bot client of the process, the bot handler and the broadcasts share it.
+func newTelegramBot(config Config) (*tgbotapi.BotAPI, error) {
+	endpoint := strings.TrimRight(config.TelegramApi, "/") + "/bot%s/%s"
+
+	bot, err := tgbotapi.NewBotAPIWithClient(config.TelegramBot, endpoint, &http.Client{Timeout: telegramTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	bot.Debug = false //!!!!
+
+	return bot, nil
+}
+
+func newTelegramNotifier(bot *tgbotapi.BotAPI) *TelegramNotifier {
+	return &TelegramNotifier{bot: bot}
+}
+
+func (n *TelegramNotifier) Channel() string {
+	return "telegram"
+}
+
+func (n *TelegramNotifier) SendText(ctx context.Context, subscriber *Subscriber, text string) error {
+	return n.send(ctx, subscriber, func(chatId int64) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(chatId, "```"+text+"```")
+		msg.ParseMode = "MarkdownV2"
+		return msg
+	})
+}
+
+func (n *TelegramNotifier) SendImage(ctx context.Context, subscriber *Subscriber, image []byte) error {
+	return n.send(ctx, subscriber, func(chatId int64) tgbotapi.Chattable {
+		return tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{
+			Name:  "picture",
+			Bytes: image,
+		})
+	})
+}
+
+// send moves the subscriber to the new chat and sends again when a group was upgraded to a supergroup.
+func (n *TelegramNotifier) send(ctx context.Context, subscriber *Subscriber, chattable func(chatId int64) tgbotapi.Chattable) error {
+	_, err := sendTelegram(ctx, n.bot, subscriber.TelegramId, chattable(subscriber.TelegramId))
+
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.MigrateToChatID == 0 {
+		return err
+	}
+
+	log.Infof("subscriber %d chat %d migrated to %d", subscriber.Id, subscriber.TelegramId, apiErr.MigrateToChatID)
+
+	if err := subscriber.migrateChat(apiErr.MigrateToChatID); err != nil {
+		log.Warnf("can't migrate subscriber %d chat: %v", subscriber.Id, err)
+		return apiErr
+	}
+
+	_, err = sendTelegram(ctx, n.bot, subscriber.TelegramId, chattable(subscriber.TelegramId))
+
+	return err
+}
+
+func (n *TelegramNotifier) ClassifyError(err error) *SendError {
+	return classifyTelegramError(err)
+}
+
+func newNotifiers(bot *tgbotapi.BotAPI) []Notifier {
+	notifiers := []Notifier{newTelegramNotifier(bot)}
+
+	if smtp := getConfig().Smtp; smtp.Host != "" {
+		notifiers = append(notifiers, newEmailNotifier(smtp))
+	}
+
+	return notifiers
+}
+
+func sendReport(ctx context.Context, notifier Notifier, subscriber *Subscriber, text string, image []byte) error {
+	if reporter, ok := notifier.(ReportNotifier); ok {
+		return reporter.SendReport(ctx, subscriber, text, image)
+	}
+
+	if err := notifier.SendText(ctx, subscriber, text); err != nil {
+		return err
+	}
+
+	if image == nil {
+		return nil
+	}
+
+	return notifier.SendImage(ctx, subscriber, image)
+}
+
+// deliver returns nil when any of the notifiers that apply to the subscriber delivered,
+// otherwise a *SendError, a transient one if there was any.
+func deliver(ctx context.Context, notifiers []Notifier, subscriber *Subscriber, text string, image []byte, delivered []string) ([]string, error) {
+	var result *SendError
+
+	for _, notifier := range notifiers {
+		if containsString(delivered, notifier.Channel()) {
+			continue
+		}
+
+		err := sendReport(ctx, notifier, subscriber, text, image)
+		if errors.Is(err, errNotApplicable) {
+			continue
+		}
+
+		if err != nil {
+			sendErr := handleSendError(notifier, subscriber, err)
+			if result == nil || sendErr.Kind == SendErrorTransient {
+				result = sendErr
+			}
+			continue
+		}
+		delivered = append(delivered, notifier.Channel())
+	}
+
+	if result == nil && len(delivered) == 0 {
+		return delivered, &SendError{Kind: SendErrorRejected, Err: errNotApplicable}
+	}
+	// a transient failure is retried on its channel alone, a final one doesn't undo the other channels
+	if result != nil && (result.Kind == SendErrorTransient || len(delivered) == 0) {
+		return delivered, result
+	}
+	return delivered, nil
+}
+
+// notify puts a broadcast to the outbox, during the subscriber's quiet hours it's queued for the summary instead.
+func notify(subscriber *Subscriber, kind string, text string, image []byte, coins []LoggedCoin) {
+	if subscriber.isQuiet(time.Now()) {
+		queueNotification(subscriber, kind, text, coins)
+		return
+	}
+
+	if err := notificationQueue.Enqueue(subscriber, kind, text, image, coins); err != nil {
+		log.Warnf("can't enqueue notification: %v", err)
+	}
+}
+
+// handleSendError disables the subscriber on a permanent error and records the reason.
+func handleSendError(notifier Notifier, subscriber *Subscriber, err error) *SendError {
+	sendErr := notifier.ClassifyError(err)
+
+	if sendErr.Kind != SendErrorPermanent {
+		log.Errorf("%s send error to subscriber %d: %v", sendErr.Kind, subscriber.Id, err)
+		return sendErr
+	}
+
+	log.Infof("subscriber %d is disabled: %s", subscriber.Id, sendErr.Reason)
+
+	if err := subscriber.disable(sendErr.Reason); err != nil {
+		log.Warnf("Error disable subscriber: %v", err)
+	}
+
+	return sendErr
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testImage = []byte("\x89PNG\r\n\x1a\nfake")
+
+func setTestConfig(fake *FakeBotAPI) {
+	setConfig(Config{
+		TelegramBot: fakeBotToken,
+		TelegramApi: fake.server.URL,
+		Quotes:      []string{"BUSD"},
+		Outbox:      defaultOutbox,
+		Jobs:        mergeJobs(defaultJobs, nil),
+		LogLevel:    "info",
+	})
+}
+
+// fastTelegramLimiter drops the pacing, so the tests don't wait a second between messages to a chat.
+func fastTelegramLimiter(t *testing.T) {
+	previous := telegramLimiter
+	telegramLimiter = newTelegramLimiter(1000, 1000, 0)
+	t.Cleanup(func() {
+		telegramLimiter = previous
+	})
+}
+
+func TestNewTelegramBot(t *testing.T) {
+	fake := newFakeBotAPI(t)
+
+	bot, err := newTelegramBot(Config{TelegramBot: fakeBotToken, TelegramApi: fake.server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.Self.UserName != "fake_bot" {
+		t.Errorf("got bot %q, want fake_bot", bot.Self.UserName)
+	}
+
+	if _, err := newTelegramBot(Config{TelegramBot: "wrong", TelegramApi: fake.server.URL}); err == nil {
+		t.Error("want an error for a wrong token")
+	}
+
+	if got := len(fake.requestsFor("getMe")); got != 1 {
+		t.Errorf("got %d getMe requests, want 1", got)
+	}
+}
+
+func TestTelegramNotifierSendsReport(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+
+	notifiers := newNotifiers(fake.bot(t))
+	subscriber := &Subscriber{Id: 1, TelegramId: 10}
+
+	if _, err := deliver(context.Background(), notifiers, subscriber, "BTC 5%", testImage, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := fake.requestsFor("sendMessage")
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	if got := messages[0].chatId(); got != 10 {
+		t.Errorf("got chat %d, want 10", got)
+	}
+	if got := messages[0].Params.Get("text"); got != "```BTC 5%```" {
+		t.Errorf("got text %q", got)
+	}
+	if got := messages[0].Params.Get("parse_mode"); got != "MarkdownV2" {
+		t.Errorf("got parse mode %q", got)
+	}
+
+	photos := fake.requestsFor("sendPhoto")
+	if len(photos) != 1 {
+		t.Fatalf("got %d photos, want 1", len(photos))
+	}
+	if !bytes.Equal(photos[0].Files["photo"], testImage) {
+		t.Errorf("got photo %q", photos[0].Files["photo"])
+	}
+}
+
+func TestDeliverFanOut(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+
+	notifiers := newNotifiers(fake.bot(t))
+	fake.fail("sendMessage", 12, FakeError{Code: http.StatusBadGateway, Description: "Bad Gateway"})
+
+	for _, chatId := range []int64{11, 12, 13} {
+		_, err := deliver(context.Background(), notifiers, &Subscriber{Id: chatId, TelegramId: chatId}, "text", nil, nil)
+
+		if chatId != 12 {
+			if err != nil {
+				t.Errorf("chat %d: %v", chatId, err)
+			}
+			continue
+		}
+
+		var sendErr *SendError
+		if !errors.As(err, &sendErr) || sendErr.Kind != SendErrorTransient {
+			t.Errorf("chat 12: got %v, want a transient error", err)
+		}
+	}
+
+	sent := make(map[int64]int)
+	for _, request := range fake.requestsFor("sendMessage") {
+		sent[request.chatId()]++
+	}
+	for _, chatId := range []int64{11, 12, 13} {
+		if sent[chatId] != 1 {
+			t.Errorf("chat %d got %d messages, want 1", chatId, sent[chatId])
+		}
+	}
+	if got := len(fake.requestsFor("sendPhoto")); got != 0 {
+		t.Errorf("got %d photos without an image", got)
+	}
+}
+
+func TestSendTelegramRetriesTooManyRequests(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	fastTelegramLimiter(t)
+	bot := fake.bot(t)
+
+	fake.fail("sendMessage", 0, FakeError{Code: http.StatusTooManyRequests, Description: "Too Many Requests: retry after 1", RetryAfter: 1})
+
+	start := time.Now()
+	if _, err := sendTelegram(context.Background(), bot, 20, tgbotapi.NewMessage(20, "text")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(fake.requestsFor("sendMessage")); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want retry_after", elapsed)
+	}
+	if telegramLimiter.tooMany != 1 {
+		t.Errorf("got %d 429 responses, want 1", telegramLimiter.tooMany)
+	}
+
+	// a longer retry_after is left to the outbox
+	fake.fail("sendMessage", 0, FakeError{Code: http.StatusTooManyRequests, Description: "Too Many Requests: retry after 60", RetryAfter: 60})
+
+	_, err := sendTelegram(context.Background(), bot, 20, tgbotapi.NewMessage(20, "text"))
+	if sendErr := classifyTelegramError(err); sendErr.Kind != SendErrorTransient || sendErr.Code != http.StatusTooManyRequests {
+		t.Errorf("got %v, want a transient 429", err)
+	}
+	if got := len(fake.requestsFor("sendMessage")); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestSendTelegramStopsWaitingOnCancel(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	fastTelegramLimiter(t)
+	bot := fake.bot(t)
+
+	fake.fail("sendMessage", 0, FakeError{Code: http.StatusTooManyRequests, Description: "Too Many Requests: retry after 20", RetryAfter: 20})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := sendTelegram(ctx, bot, 21, tgbotapi.NewMessage(21, "text"))
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want on cancel", elapsed)
+	}
+	if sendErr := classifyTelegramError(err); sendErr.Kind != SendErrorTransient {
+		t.Errorf("got %s, want the notification retried", sendErr.Kind)
+	}
+	if got := len(fake.requestsFor("sendMessage")); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestTelegramNotifierClassifiesErrors(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	fastTelegramLimiter(t)
+	notifier := newTelegramNotifier(fake.bot(t))
+
+	tests := []struct {
+		err    FakeError
+		kind   string
+		reason string
+	}{
+		{FakeError{Code: 403, Description: "Forbidden: bot was blocked by the user"}, SendErrorPermanent, DisabledReasonBlocked},
+		{FakeError{Code: 403, Description: "Forbidden: user is deactivated"}, SendErrorPermanent, DisabledReasonDeactivated},
+		{FakeError{Code: 403, Description: "Forbidden: bot can't initiate conversation with a user"}, SendErrorPermanent, DisabledReasonNotStarted},
+		{FakeError{Code: 400, Description: "Bad Request: chat not found"}, SendErrorPermanent, DisabledReasonChatNotFound},
+		{FakeError{Code: 400, Description: "Bad Request: message is too long"}, SendErrorRejected, ""},
+		{FakeError{Code: 500, Description: "Internal Server Error"}, SendErrorTransient, ""},
+	}
+
+	for _, test := range tests {
+		fake.fail("sendMessage", 30, test.err)
+
+		err := notifier.SendText(context.Background(), &Subscriber{Id: 30, TelegramId: 30}, "text")
+		if err == nil {
+			t.Errorf("%s: no error", test.err.Description)
+			continue
+		}
+
+		sendErr := notifier.ClassifyError(err)
+		if sendErr.Kind != test.kind || sendErr.Reason != test.reason || sendErr.Code != test.err.Code {
+			t.Errorf("%s: got %s %q %d, want %s %q %d", test.err.Description,
+				sendErr.Kind, sendErr.Reason, sendErr.Code, test.kind, test.reason, test.err.Code)
+		}
+	}
+
+	// without the subscriber moved the migration is retried, it never disables
+	migrated := &tgbotapi.Error{Code: 400, Message: "Bad Request: group chat was upgraded to a supergroup chat",
+		ResponseParameters: tgbotapi.ResponseParameters{MigrateToChatID: -100}}
+	if sendErr := classifyTelegramError(migrated); sendErr.Kind != SendErrorTransient {
+		t.Errorf("got %s, want a transient error", sendErr.Kind)
+	}
+}
+
+func TestTelegramNotifierFollowsMigratedChat(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	testDatabase(t)
+
+	subscriber, err := (&Subscriber{}).addNew(&tgbotapi.Chat{ID: -60, Type: "group"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.fail("sendMessage", -60, FakeError{Code: 400, Description: "Bad Request: group chat was upgraded to a supergroup chat", MigrateToChatId: -10060})
+
+	if _, err := deliver(context.Background(), newNotifiers(fake.bot(t)), subscriber, "text", nil, nil); err != nil {
+		t.Fatalf("got %v, want delivered to the supergroup", err)
+	}
+
+	messages := fake.requestsFor("sendMessage")
+	if len(messages) != 2 || messages[0].chatId() != -60 || messages[1].chatId() != -10060 {
+		t.Errorf("got messages %+v, want the old chat then the supergroup", messages)
+	}
+
+	stored := &Subscriber{Id: subscriber.Id}
+	if err := dbConnect.Model(stored).WherePK().Select(); err != nil {
+		t.Fatal(err)
+	}
+	if stored.TelegramId != -10060 || stored.IsEnabled != Subscriber_IS_ENABLED_TRUE {
+		t.Errorf("got chat %d enabled %d, want the supergroup enabled", stored.TelegramId, stored.IsEnabled)
+	}
+}
+
+func TestFakeBotAPIUpdates(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	bot := fake.bot(t)
+
+	config := tgbotapi.NewUpdate(0)
+	config.Timeout = 10
+	updates := bot.GetUpdatesChan(config)
+	defer bot.StopReceivingUpdates()
+
+	fake.pushMessage(40, "/thresholds 1h 5")
+	fake.pushCallbackQuery(40, "refresh")
+
+	var received []tgbotapi.Update
+	for len(received) < 2 {
+		select {
+		case update := <-updates:
+			received = append(received, update)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d updates, want 2", len(received))
+		}
+	}
+
+	message := received[0].Message
+	if message == nil || message.Command() != "thresholds" || message.CommandArguments() != "1h 5" || message.Chat.ID != 40 {
+		t.Fatalf("got message %+v", message)
+	}
+
+	callback := received[1].CallbackQuery
+	if callback == nil || callback.Data != "refresh" {
+		t.Fatalf("got callback %+v", callback)
+	}
+
+	if _, err := bot.Request(tgbotapi.NewCallback(callback.ID, "ok")); err != nil {
+		t.Fatal(err)
+	}
+
+	answers := fake.requestsFor("answerCallbackQuery")
+	if len(answers) != 1 || answers[0].Params.Get("callback_query_id") != callback.ID {
+		t.Errorf("got answers %+v", answers)
+	}
+}
+
+func TestDeliverSkipsChannelsWithoutAddress(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	stub := newSmtpStub(t)
+
+	notifiers := []Notifier{newTelegramNotifier(fake.bot(t)), newEmailNotifier(stub.config())}
+
+	// email is configured, but the subscriber has no address, so the telegram failure decides
+	fake.fail("sendMessage", 50, FakeError{Code: http.StatusBadGateway, Description: "Bad Gateway"})
+
+	_, err := deliver(context.Background(), notifiers, &Subscriber{Id: 50, TelegramId: 50}, "text", nil, nil)
+
+	var sendErr *SendError
+	if !errors.As(err, &sendErr) || sendErr.Kind != SendErrorTransient {
+		t.Errorf("got %v, want a transient error", err)
+	}
+	if isFinalSendError(err) {
+		t.Error("want the notification retried")
+	}
+
+	// with an address the email delivers, the telegram failure is retried on telegram alone
+	fake.fail("sendMessage", 51, FakeError{Code: http.StatusBadGateway, Description: "Bad Gateway"})
+	subscriber := &Subscriber{Id: 51, TelegramId: 51, Email: "user@example.com"}
+
+	delivered, err := deliver(context.Background(), notifiers, subscriber, "text", nil, nil)
+	if !errors.As(err, &sendErr) || sendErr.Kind != SendErrorTransient {
+		t.Errorf("got %v, want a transient error", err)
+	}
+	if len(delivered) != 1 || delivered[0] != "email" {
+		t.Errorf("got delivered %v, want email", delivered)
+	}
+	if message := stub.waitMessage(t); message.To[0] != "user@example.com" {
+		t.Errorf("got email to %v", message.To)
+	}
+
+	delivered, err = deliver(context.Background(), notifiers, subscriber, "text", nil, delivered)
+	if err != nil {
+		t.Errorf("got %v, want delivered by telegram", err)
+	}
+	if len(delivered) != 2 {
+		t.Errorf("got delivered %v, want both channels", delivered)
+	}
+	if messages := fake.requestsFor("sendMessage"); len(messages) != 3 || messages[2].chatId() != 51 {
+		t.Errorf("got messages %+v, want the retry to chat 51", messages)
+	}
+
+	select {
+	case message := <-stub.messages:
+		t.Errorf("got an email to %v without an address", message.To)
+	default:
+	}
+}
+
+// TestOutboxRetriesFailedChannel keeps the email delivered on the first attempt and sends the retry to telegram alone.
+func TestOutboxRetriesFailedChannel(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	setTestConfig(fake)
+	fastTelegramLimiter(t)
+	testDatabase(t)
+	stub := newSmtpStub(t)
+
+	subscriber, err := (&Subscriber{}).addNew(&tgbotapi.Chat{ID: 53, FirstName: "Both"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := subscriber.updateEmail("user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enqueueNotification(subscriber, NotificationKindMovers, "text", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	notifiers := []Notifier{newTelegramNotifier(fake.bot(t)), newEmailNotifier(stub.config())}
+	fake.fail("sendMessage", 53, FakeError{Code: http.StatusBadGateway, Description: "Bad Gateway"})
+
+	notification, err := claimNotification()
+	if err != nil || notification == nil {
+		t.Fatalf("got %v: %v, want the notification", notification, err)
+	}
+	sendNotification(context.Background(), notifiers, notification)
+	stub.waitMessage(t)
+
+	stored := &NotificationsLogs{Id: notification.Id}
+	if err := dbConnect.Model(stored).WherePK().Select(); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != NotificationStatusFailed || len(stored.DeliveredChannels) != 1 || stored.DeliveredChannels[0] != "email" {
+		t.Fatalf("got status %s, channels %v, want failed after the email", stored.Status, stored.DeliveredChannels)
+	}
+
+	// the retry is due at once
+	if _, err := dbConnect.Model(stored).Set("next_attempt_at = ?", time.Now()).WherePK().Update(); err != nil {
+		t.Fatal(err)
+	}
+	notification, err = claimNotification()
+	if err != nil || notification == nil {
+		t.Fatalf("got %v: %v, want the retry", notification, err)
+	}
+	sendNotification(context.Background(), notifiers, notification)
+
+	if err := dbConnect.Model(stored).WherePK().Select(); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != NotificationStatusSent || len(stored.DeliveredChannels) != 2 {
+		t.Errorf("got status %s, channels %v, want sent on both", stored.Status, stored.DeliveredChannels)
+	}
+	if messages := fake.requestsFor("sendMessage"); len(messages) != 2 {
+		t.Errorf("got %d telegram messages, want the failed one and the retry", len(messages))
+	}
+	select {
+	case message := <-stub.messages:
+		t.Errorf("got the email again to %v", message.To)
+	default:
+	}
+}
+
+func TestDeliverWithoutApplicableChannel(t *testing.T) {
+	stub := newSmtpStub(t)
+
+	_, err := deliver(context.Background(), []Notifier{newEmailNotifier(stub.config())}, &Subscriber{Id: 52}, "text", nil, nil)
+
+	if !errors.Is(err, errNotApplicable) || !isFinalSendError(err) {
+		t.Errorf("got %v, want a final not applicable error", err)
+	}
+}
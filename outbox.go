@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/olekukonko/tablewriter"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	// outboxLease postpones a claimed notification, so it's retried when the worker died while sending it
+	outboxLease      = 5 * time.Minute
+	outboxBackoff    = 30 * time.Second
+	outboxMaxBackoff = time.Hour
+)
+
+var defaultOutbox = Outbox{
+	Workers:     4,
+	MaxAttempts: 8,
+}
+
+// NotificationQueue takes the broadcasts for delivery.
+type NotificationQueue interface {
+	Enqueue(subscriber *Subscriber, kind string, text string, image []byte, coins []LoggedCoin) error
+}
+
+// OutboxQueue is the Postgres outbox, the workers deliver its notifications.
+type OutboxQueue struct{}
+
+var notificationQueue NotificationQueue = OutboxQueue{}
+
+func (OutboxQueue) Enqueue(subscriber *Subscriber, kind string, text string, image []byte, coins []LoggedCoin) error {
+	return enqueueNotification(subscriber, kind, text, image, coins)
+}
+
+// outboxWake wakes an idle worker when a notification is queued.
+var outboxWake = make(chan struct{}, 1)
+
+func wakeOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func enqueueNotification(subscriber *Subscriber, kind string, text string, image []byte, coins []LoggedCoin) error {
+	_, err := dbConnect.Model(&NotificationsLogs{
+		SubscriberId:  subscriber.Id,
+		Notification:  text,
+		Kind:          kind,
+		Fingerprint:   fingerprint(text),
+		Coins:         coins,
+		Image:         image,
+		Status:        NotificationStatusPending,
+		NextAttemptAt: time.Now(),
+		CreatedAt:     time.Now(),
+	}).Insert()
+
+	if err != nil {
+		return err
+	}
+
+	wakeOutbox()
+
+	return nil
+}
+
+// outboxBackoffAfter doubles the delay with every attempt.
+func outboxBackoffAfter(attempts int) time.Duration {
+	backoff := outboxBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
+
+// startOutbox runs the workers until ctx is done, every worker finishes the notification in hand.
+func startOutbox(ctx context.Context, bot *tgbotapi.BotAPI, workers int) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outboxWorker(ctx, bot)
+		}()
+	}
+
+	return wg
+}
+
+func outboxWorker(ctx context.Context, bot *tgbotapi.BotAPI) {
+	var notifiers []Notifier
+
+	for ctx.Err() == nil {
+		notification, err := claimNotification()
+		if err != nil {
+			log.Warnf("can't claim notification: %v", err)
+		}
+
+		if notification == nil {
+			// the notifiers are created again after idle, so smtp changes are applied
+			notifiers = nil
+
+			select {
+			case <-ctx.Done():
+			case <-outboxWake:
+			case <-time.After(outboxPollInterval):
+			}
+			continue
+		}
+
+		// there may be more, let another worker join
+		wakeOutbox()
+
+		if notifiers == nil {
+			notifiers = newNotifiers(bot)
+		}
+
+		sendNotification(ctx, notifiers, notification)
+	}
+}
+
+// claimNotification takes the oldest due notification, replicas skip the rows claimed by others.
+func claimNotification() (*NotificationsLogs, error) {
+	notification := &NotificationsLogs{}
+
+	_, err := dbConnect.QueryOne(notification, `
+		UPDATE notifications_logs
+		SET attempts = attempts + 1, next_attempt_at = ?0, updated_at = ?1
+		WHERE id = (
+			SELECT id
+			FROM notifications_logs
+			WHERE status IN (?2, ?3)
+			  AND next_attempt_at <= ?1
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		time.Now().Add(outboxLease), time.Now(), NotificationStatusPending, NotificationStatusFailed)
+
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// sendNotification gives up the waits when ctx is done, the notification is retried after the restart.
+func sendNotification(ctx context.Context, notifiers []Notifier, notification *NotificationsLogs) {
+	subscriber := &Subscriber{Id: notification.SubscriberId}
+	if err := dbConnect.Model(subscriber).WherePK().Select(); err != nil {
+		failNotification(notification, err, false)
+		return
+	}
+
+	if subscriber.IsEnabled == Subscriber_IS_ENABLED_FALSE {
+		failNotification(notification, errors.New("subscriber is disabled: "+subscriber.DisabledReason), true)
+		return
+	}
+
+	delivered, err := deliver(ctx, notifiers, subscriber, notification.Notification, notification.Image, notification.DeliveredChannels)
+	notification.DeliveredChannels = delivered
+	if err != nil {
+		failNotification(notification, err, isFinalSendError(err))
+		return
+	}
+
+	notification.Status = NotificationStatusSent
+	notification.SentAt = time.Now()
+	notification.UpdatedAt = time.Now()
+
+	_, err = dbConnect.Model(notification).
+		Set("status = ?status").
+		Set("delivered_channels = ?delivered_channels").
+		Set("sent_at = ?sent_at").
+		Set("updated_at = ?updated_at").
+		Set("image = NULL").
+		Set("last_error = NULL").
+		WherePK().
+		Update()
+
+	if err != nil {
+		log.Warnf("can't update notification %d: %v", notification.Id, err)
+	}
+}
+
+// failNotification schedules a retry with backoff, a final error or the last attempt makes the notification dead.
+func failNotification(notification *NotificationsLogs, sendErr error, final bool) {
+	notification.Status = NotificationStatusFailed
+	notification.NextAttemptAt = time.Now().Add(outboxBackoffAfter(notification.Attempts))
+	notification.LastError = sendErr.Error()
+	notification.UpdatedAt = time.Now()
+
+	if final || notification.Attempts >= getConfig().Outbox.MaxAttempts {
+		notification.Status = NotificationStatusDead
+		log.Warnf("notification %d is dead after %d attempts: %v", notification.Id, notification.Attempts, sendErr)
+	}
+
+	query := dbConnect.Model(notification).
+		Set("status = ?status").
+		Set("next_attempt_at = ?next_attempt_at").
+		Set("delivered_channels = ?delivered_channels").
+		Set("last_error = ?last_error").
+		Set("updated_at = ?updated_at")
+
+	if notification.Status == NotificationStatusDead {
+		query.Set("image = NULL")
+	}
+
+	if _, err := query.WherePK().Update(); err != nil {
+		log.Warnf("can't update notification %d: %v", notification.Id, err)
+	}
+}
+
+type outboxStatusCount struct {
+	Status string
+	Count  int
+}
+
+func handleOutboxCommand(subscriber *Subscriber) string {
+	if !isAdmin(subscriber) {
+		return "The command is for admins only"
+	}
+
+	var counts []outboxStatusCount
+	_, err := dbConnect.Query(&counts, `
+		SELECT status, count(*) AS count
+		FROM notifications_logs
+		WHERE created_at >= ?
+		GROUP BY status
+		ORDER BY status`, time.Now().Add(-24*time.Hour))
+
+	if err != nil {
+		log.Warnf("can't get outbox status: %v", err)
+		return "Возникла ошибка №435/10"
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Status", "Count"})
+	table.SetCaption(true, fmt.Sprintf("Notifications for 24h, %d workers.", getConfig().Outbox.Workers))
+
+	for _, count := range counts {
+		table.Append([]string{count.Status, IntToStr(count.Count)})
+	}
+
+	table.Render()
+
+	return tableString.String()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const percentCoinsLimit = 45
+
+// percentWindow takes the klines opened since now - Duration rounded down to Round.
+type percentWindow struct {
+	Duration time.Duration
+	Round    time.Duration
+	// Spanning also takes the kline opened before the start that is still open
+	Spanning bool
+}
+
+// percentWindows are 10m, 1h, 4h, 12h and 24h, the order of the PercentCoin fields.
+type percentWindows [5]percentWindow
+
+var (
+	// moverWindows take the open kline into the 10 minutes, so a move that just started counts
+	moverWindows = percentWindows{
+		{Duration: 10 * time.Minute, Round: 10 * time.Minute, Spanning: true},
+		{Duration: time.Hour, Round: time.Hour},
+		{Duration: 4 * time.Hour, Round: time.Hour},
+		{Duration: 12 * time.Hour, Round: time.Hour},
+		{Duration: 24 * time.Hour},
+	}
+	// rateWindows are the exchange rate windows, all of them from the window start only
+	rateWindows = percentWindows{
+		{Duration: 10 * time.Minute, Round: 10 * time.Minute},
+		{Duration: time.Hour, Round: time.Hour},
+		{Duration: 4 * time.Hour, Round: time.Hour},
+		{Duration: 12 * time.Hour, Round: time.Hour},
+		{Duration: 24 * time.Hour},
+	}
+)
+
+type windowStats struct {
+	FirstOpen float64
+	LastClose float64
+	MinOpen   float64
+	MaxClose  float64
+	Count     int
+}
+
+// coinKlines are the last day klines of one coin ordered by open time.
+type coinKlines struct {
+	CoinId int64
+	Code   string
+	Rank   int
+	Klines []Kline
+}
+
+// coinStats are the stats of the percentWindows of one coin.
+type coinStats struct {
+	CoinId  int64
+	Code    string
+	Rank    int
+	Windows [5]windowStats
+}
+
+func (w percentWindow) start(now time.Time) time.Time {
+	start := now.Add(-w.Duration)
+	if w.Round > 0 {
+		start = start.Truncate(w.Round)
+	}
+	return start
+}
+
+func (w percentWindow) contains(kline Kline, now time.Time) bool {
+	start := w.start(now)
+
+	if !kline.OpenTime.Before(start) {
+		return true
+	}
+
+	return w.Spanning && !kline.CloseTime.Before(now)
+}
+
+func (w percentWindow) stats(klines []Kline, now time.Time) windowStats {
+	var stats windowStats
+	var first, last time.Time
+
+	for _, kline := range klines {
+		if !w.contains(kline, now) {
+			continue
+		}
+
+		if stats.Count == 0 || kline.OpenTime.Before(first) {
+			first = kline.OpenTime
+			stats.FirstOpen = kline.Open
+		}
+		if stats.Count == 0 || !kline.OpenTime.Before(last) {
+			last = kline.OpenTime
+			stats.LastClose = kline.Close
+		}
+		if stats.Count == 0 || kline.Open < stats.MinOpen {
+			stats.MinOpen = kline.Open
+		}
+		if stats.Count == 0 || kline.Close > stats.MaxClose {
+			stats.MaxClose = kline.Close
+		}
+
+		stats.Count++
+	}
+
+	return stats
+}
+
+// earliest is the start of the longest window.
+func (w percentWindows) earliest(now time.Time) time.Time {
+	earliest := now
+	for _, window := range w {
+		if start := window.start(now); start.Before(earliest) {
+			earliest = start
+		}
+	}
+	return earliest
+}
+
+func (w percentWindows) stats(coin coinKlines, now time.Time) coinStats {
+	result := coinStats{CoinId: coin.CoinId, Code: coin.Code, Rank: coin.Rank}
+
+	for i, window := range w {
+		result.Windows[i] = window.stats(coin.Klines, now)
+	}
+
+	return result
+}
+
+func calcPercent(open float64, close float64) float64 {
+	if open == 0 {
+		return 0
+	}
+	return (close - open) / open * 100
+}
+
+// calcPercentCoinShort is the change from the first open to the last close of every window.
+func calcPercentCoinShort(coin coinStats) PercentCoinShort {
+	percent := func(stats windowStats) float64 {
+		return calcPercent(stats.FirstOpen, stats.LastClose)
+	}
+
+	result := PercentCoinShort{
+		CoinId:   coin.CoinId,
+		Rank:     coin.Rank,
+		Code:     coin.Code,
+		Minute10: percent(coin.Windows[0]),
+		Hour:     percent(coin.Windows[1]),
+		Hour4:    percent(coin.Windows[2]),
+		Hour12:   percent(coin.Windows[3]),
+		Hour24:   percent(coin.Windows[4]),
+	}
+	result.PercentSum = math.Round((result.Minute10+result.Hour+result.Hour4+result.Hour12+result.Hour24)*1000) / 1000
+
+	return result
+}
+
+// calcPercentCoin is the change from the lowest open to the highest close of every window.
+func calcPercentCoin(coin coinStats) PercentCoin {
+	result := PercentCoin{
+		CoinId: coin.CoinId,
+		Rank:   coin.Rank,
+		Code:   coin.Code,
+	}
+
+	window := func(stats windowStats, percent *float64, minOpen *float64, maxClose *float64) {
+		if stats.Count == 0 {
+			return
+		}
+		*percent = calcPercent(stats.MinOpen, stats.MaxClose)
+		*minOpen = stats.MinOpen
+		*maxClose = stats.MaxClose
+	}
+
+	window(coin.Windows[0], &result.Minute10, &result.Minute10MinOpen, &result.Minute10MaxClose)
+	window(coin.Windows[1], &result.Hour, &result.HourMinOpen, &result.HourMaxClose)
+	window(coin.Windows[2], &result.Hour4, &result.Hour4MinOpen, &result.Hour4MaxClose)
+	window(coin.Windows[3], &result.Hour12, &result.Hour12MinOpen, &result.Hour12MaxClose)
+	window(coin.Windows[4], &result.Hour24, &result.Hour24MinOpen, &result.Hour24MaxClose)
+
+	return result
+}
+
+// calcPercentCoins takes the first coins by id and orders them by the percent sum.
+func calcPercentCoins(coins []coinStats) []PercentCoinShort {
+	sorted := make([]coinStats, 0, len(coins))
+	for _, coin := range coins {
+		if coin.Windows[4].Count > 0 {
+			sorted = append(sorted, coin)
+		}
+	}
+
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].CoinId < sorted[b].CoinId
+	})
+
+	if len(sorted) > percentCoinsLimit {
+		sorted = sorted[:percentCoinsLimit]
+	}
+
+	result := make([]PercentCoinShort, 0, len(sorted))
+	for _, coin := range sorted {
+		result = append(result, calcPercentCoinShort(coin))
+	}
+
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a].PercentSum > result[b].PercentSum
+	})
+
+	return result
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var percentNow = time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC)
+
+func percentKline(open time.Time, duration time.Duration, openPrice float64, closePrice float64) Kline {
+	return Kline{OpenTime: open, CloseTime: open.Add(duration - time.Millisecond), Open: openPrice, Close: closePrice}
+}
+
+func TestCalcPercentCoin(t *testing.T) {
+	// the 10 minutes start at 11:50, the open 30 minutes kline started before
+	openKline := percentKline(percentNow.Add(-20*time.Minute), 30*time.Minute, 100, 104)
+	closed := percentKline(percentNow.Add(-3*time.Hour), time.Hour, 90, 95)
+
+	tests := []struct {
+		name     string
+		windows  percentWindows
+		klines   []Kline
+		minute10 float64
+		hour     float64
+		hour4    float64
+		hour24   float64
+	}{
+		{"empty", moverWindows, nil, 0, 0, 0, 0},
+		{"single kline", moverWindows, []Kline{percentKline(percentNow.Add(-5*time.Minute), 5*time.Minute, 100, 110)}, 10, 10, 10, 10},
+		{"open kline, movers", moverWindows, []Kline{closed, openKline}, 4, 4, calcPercent(90, 104), calcPercent(90, 104)},
+		{"open kline, rate", rateWindows, []Kline{closed, openKline}, 0, 4, calcPercent(90, 104), calcPercent(90, 104)},
+	}
+
+	for _, test := range tests {
+		coin := coinKlines{CoinId: 1, Code: "BTC", Klines: test.klines}
+		rate := calcPercentCoin(test.windows.stats(coin, percentNow))
+
+		if rate.Code != "BTC" || rate.Minute10 != test.minute10 || rate.Hour != test.hour || rate.Hour4 != test.hour4 || rate.Hour24 != test.hour24 {
+			t.Errorf("%s: got %v %v %v %v, want %v %v %v %v", test.name,
+				rate.Minute10, rate.Hour, rate.Hour4, rate.Hour24, test.minute10, test.hour, test.hour4, test.hour24)
+		}
+	}
+
+	// an empty window has no prices rather than a zero one
+	rate := calcPercentCoin(rateWindows.stats(coinKlines{Klines: []Kline{closed, openKline}}, percentNow))
+	if rate.Minute10MinOpen != 0 || rate.Minute10MaxClose != 0 || rate.HourMinOpen != 100 || rate.HourMaxClose != 104 {
+		t.Errorf("got 10m %v-%v, 1h %v-%v", rate.Minute10MinOpen, rate.Minute10MaxClose, rate.HourMinOpen, rate.HourMaxClose)
+	}
+}
+
+func TestCalcPercentCoins(t *testing.T) {
+	kline := func(openPrice float64, closePrice float64) []Kline {
+		return []Kline{percentKline(percentNow.Add(-5*time.Minute), 5*time.Minute, openPrice, closePrice)}
+	}
+
+	var coins []coinStats
+	for _, coin := range []coinKlines{
+		{CoinId: 3, Code: "DOWN", Klines: kline(100, 90)},
+		{CoinId: 1, Code: "UP", Klines: kline(100, 110)},
+		{CoinId: 2, Code: "EMPTY"},
+		{CoinId: 4, Code: "FLAT", Klines: kline(100, 100)},
+	} {
+		coins = append(coins, moverWindows.stats(coin, percentNow))
+	}
+
+	result := calcPercentCoins(coins)
+
+	want := []string{"UP", "FLAT", "DOWN"}
+	if len(result) != len(want) {
+		t.Fatalf("got %d coins, want %v", len(result), want)
+	}
+	for i, code := range want {
+		if result[i].Code != code {
+			t.Errorf("coin %d: got %s, want %s", i, result[i].Code, code)
+		}
+	}
+	if result[0].PercentSum != 50 || result[2].PercentSum != -50 {
+		t.Errorf("got sums %v and %v, want 50 and -50", result[0].PercentSum, result[2].PercentSum)
+	}
+
+	// the limit takes the first coins by id, not the biggest movers
+	coins = nil
+	for id := int64(percentCoinsLimit + 5); id > 0; id-- {
+		coins = append(coins, moverWindows.stats(coinKlines{CoinId: id, Klines: kline(100, 100+float64(id))}, percentNow))
+	}
+
+	result = calcPercentCoins(coins)
+	if len(result) != percentCoinsLimit || result[0].CoinId != percentCoinsLimit {
+		t.Errorf("got %d coins starting with %d, want %d", len(result), result[0].CoinId, percentCoinsLimit)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-pg/pg/v10"
+	"github.com/olekukonko/tablewriter"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// queuedNotificationsTTL drops the queue of subscribers that never leave quiet hours, e.g. disabled ones.
+const queuedNotificationsTTL = 48 * time.Hour
+
+func (q QuietHours) String() string {
+	if q.From == q.To {
+		return "off"
+	}
+	return fmt.Sprintf("%02d:00-%02d:00", q.From, q.To)
+}
+
+func parseQuietHours(value string) (QuietHours, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	if len(bounds) != 2 {
+		return QuietHours{}, errors.New("quiet hours must look like 23-7")
+	}
+
+	from, errFrom := strconv.Atoi(strings.TrimSuffix(bounds[0], ":00"))
+	to, errTo := strconv.Atoi(strings.TrimSuffix(bounds[1], ":00"))
+	if errFrom != nil || errTo != nil || from < 0 || from > 23 || to < 0 || to > 23 {
+		return QuietHours{}, errors.New("quiet hours must be between 0 and 23, e.g. 23-7")
+	}
+
+	return QuietHours{From: from, To: to}, nil
+}
+
+// location is the subscriber's timezone, the server one until the subscriber sets it.
+func (s *Subscriber) location() *time.Location {
+	if s.Timezone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Local
+	}
+
+	return location
+}
+
+// quietHours are local hours of the subscriber, nil QuietFrom/QuietTo mean the config ones.
+func (s *Subscriber) quietHours() QuietHours {
+	if s.QuietFrom == nil || s.QuietTo == nil {
+		return getConfig().QuietHours
+	}
+	return QuietHours{From: *s.QuietFrom, To: *s.QuietTo}
+}
+
+func (s *Subscriber) isQuiet(now time.Time) bool {
+	return s.quietHours().contains(now.In(s.location()).Hour())
+}
+
+func (s *Subscriber) updateQuietSettings() (err error) {
+	s.UpdatedAt = time.Now()
+	_, err = dbConnect.Model(s).
+		Set("timezone = ?timezone").
+		Set("quiet_from = ?quiet_from").
+		Set("quiet_to = ?quiet_to").
+		Set("updated_at = ?updated_at").
+		Where("id = ?id").
+		Update()
+
+	return err
+}
+
+func (s *Subscriber) settingsString() string {
+	timezone := s.Timezone
+	if timezone == "" {
+		timezone = "server " + time.Now().Format("MST")
+	}
+
+	quietHours := s.quietHours().String()
+	if s.QuietFrom == nil || s.QuietTo == nil {
+		quietHours += " (default)"
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Setting", "Value"})
+
+	table.Append([]string{"Timezone", timezone})
+	table.Append([]string{"Local time", time.Now().In(s.location()).Format("15:04")})
+	table.Append([]string{"Quiet hours", quietHours})
+	table.Append([]string{"Quote", s.getQuote()})
+
+	table.Render()
+
+	return tableString.String()
+}
+
+func handleSettingsCommand(subscriber *Subscriber, arguments string) string {
+	args := strings.Fields(arguments)
+	usage := "Usage: /settings timezone <Europe/Berlin|reset>, /settings quiet <23-7|off|reset>"
+
+	switch {
+	case len(args) == 0:
+		return subscriber.settingsString() + "\n" + usage
+	case len(args) == 2 && (args[0] == "timezone" || args[0] == "tz"):
+		if args[1] == "reset" {
+			subscriber.Timezone = ""
+			break
+		}
+
+		location, err := time.LoadLocation(args[1])
+		if err != nil || args[1] == "Local" {
+			return "Unknown timezone " + args[1] + ", use a name like Europe/Berlin"
+		}
+		subscriber.Timezone = location.String()
+	case len(args) == 2 && args[0] == "quiet":
+		switch args[1] {
+		case "reset":
+			subscriber.QuietFrom, subscriber.QuietTo = nil, nil
+		case "off":
+			from, to := 0, 0
+			subscriber.QuietFrom, subscriber.QuietTo = &from, &to
+		default:
+			quietHours, err := parseQuietHours(args[1])
+			if err != nil {
+				return err.Error()
+			}
+			subscriber.QuietFrom, subscriber.QuietTo = &quietHours.From, &quietHours.To
+		}
+	default:
+		return usage
+	}
+
+	if err := subscriber.updateQuietSettings(); err != nil {
+		log.Warnf("can't update subscriber settings: %v", err)
+		return "Возникла ошибка №435/9"
+	}
+
+	return subscriber.settingsString()
+}
+
+func queueNotification(subscriber *Subscriber, kind string, text string, coins []LoggedCoin) {
+	_, err := dbConnect.Model(&QueuedNotification{
+		SubscriberId: subscriber.Id,
+		Kind:         kind,
+		Notification: text,
+		Coins:        coins,
+		CreatedAt:    time.Now(),
+	}).Insert()
+
+	if err != nil {
+		log.Warnf("can't queue notification: %v", err)
+	}
+}
+
+// sendQuietSummaries delivers one summary of the queued notifications to every subscriber whose quiet hours are over.
+func sendQuietSummaries(ctx context.Context) {
+	var queued []QueuedNotification
+	err := dbConnect.Model(&queued).
+		Where("created_at >= ?", time.Now().Add(-queuedNotificationsTTL)).
+		Order("id").
+		Select()
+
+	if err != nil {
+		log.Warnf("can't get queued notifications: %v", err)
+		return
+	}
+
+	defer deleteExpiredQueuedNotifications()
+
+	if len(queued) == 0 {
+		return
+	}
+
+	grouped := make(map[int64][]QueuedNotification)
+	var ids []int64
+	for _, notification := range queued {
+		if _, ok := grouped[notification.SubscriberId]; !ok {
+			ids = append(ids, notification.SubscriberId)
+		}
+		grouped[notification.SubscriberId] = append(grouped[notification.SubscriberId], notification)
+	}
+
+	var subscribers []Subscriber
+	err = dbConnect.Model(&subscribers).
+		Where("is_enabled = ?", 1).
+		Where("id IN (?)", pg.In(ids)).
+		Select()
+
+	if err != nil {
+		log.Warnf("can't get subscribers: %v", err)
+		return
+	}
+
+	now := time.Now()
+	var summarized []int64
+
+	for i := range subscribers {
+		if ctx.Err() != nil {
+			break
+		}
+
+		subscriber := &subscribers[i]
+		if subscriber.isQuiet(now) {
+			continue
+		}
+
+		text := formatQuietSummary(grouped[subscriber.Id])
+
+		if err := enqueueNotification(subscriber, NotificationKindQuietSummary, text, nil, nil); err != nil {
+			log.Warnf("can't enqueue notification: %v", err)
+			continue
+		}
+
+		for _, notification := range grouped[subscriber.Id] {
+			summarized = append(summarized, notification.Id)
+		}
+	}
+
+	if len(summarized) == 0 {
+		return
+	}
+
+	_, err = dbConnect.Model((*QueuedNotification)(nil)).
+		Where("id IN (?)", pg.In(summarized)).
+		Delete()
+
+	if err != nil {
+		log.Warnf("can't delete queued notifications: %v", err)
+	}
+}
+
+func deleteExpiredQueuedNotifications() {
+	_, err := dbConnect.Model((*QueuedNotification)(nil)).
+		Where("created_at < ?", time.Now().Add(-queuedNotificationsTTL)).
+		Delete()
+
+	if err != nil {
+		log.Warnf("can't delete expired queued notifications: %v", err)
+	}
+}
+
+// formatQuietSummary keeps the biggest move of every coin, all the price alerts and the latest of other texts.
+func formatQuietSummary(notifications []QueuedNotification) string {
+	type summaryCoin struct {
+		kind string
+		coin LoggedCoin
+	}
+
+	var coins []*summaryCoin
+	coinsIndex := make(map[string]*summaryCoin)
+	var texts []string
+	latestTexts := make(map[string]int)
+
+	for _, notification := range notifications {
+		if len(notification.Coins) == 0 {
+			if index, ok := latestTexts[notification.Kind]; ok && notification.Kind != NotificationKindPriceAlert {
+				texts[index] = notification.Notification
+				continue
+			}
+			latestTexts[notification.Kind] = len(texts)
+			texts = append(texts, notification.Notification)
+			continue
+		}
+
+		for _, coin := range notification.Coins {
+			key := notification.Kind + ":" + coin.Code + ":" + coin.Direction
+			if item, ok := coinsIndex[key]; ok {
+				if coin.Value > item.coin.Value {
+					item.coin.Value = coin.Value
+				}
+				continue
+			}
+
+			item := &summaryCoin{kind: notification.Kind, coin: coin}
+			coinsIndex[key] = item
+			coins = append(coins, item)
+		}
+	}
+
+	sort.SliceStable(coins, func(a, b int) bool {
+		if coins[a].kind != coins[b].kind {
+			return coins[a].kind < coins[b].kind
+		}
+		return coins[a].coin.Value > coins[b].coin.Value
+	})
+
+	caption := fmt.Sprintf("%d delayed notifications.", len(notifications))
+	result := caption + "\n"
+
+	if len(coins) > 0 {
+		tableString := &strings.Builder{}
+		table := tablewriter.NewWriter(tableString)
+		table.SetHeader([]string{"Kind", "Name", "Max"})
+		table.SetCaption(true, caption)
+
+		for _, item := range coins {
+			value := item.coin.Direction + " " + FloatToStr(item.coin.Value) + "%"
+			if item.coin.Direction == "spike" {
+				value = FloatToStr(item.coin.Value) + "x"
+			}
+
+			table.Append([]string{item.kind, item.coin.Code, value})
+		}
+
+		table.Render()
+
+		result = tableString.String()
+	}
+
+	for _, text := range texts {
+		result += "\n" + text
+	}
+
+	if len(result) > 4000 {
+		return result[:4000]
+	}
+
+	return result
+}
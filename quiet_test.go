@@ -0,0 +1,149 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursContains(t *testing.T) {
+	tests := []struct {
+		quietHours QuietHours
+		quiet      []int
+		loud       []int
+	}{
+		{QuietHours{From: 2, To: 7}, []int{2, 3, 6}, []int{0, 1, 7, 12, 23}},
+		{QuietHours{From: 22, To: 7}, []int{22, 23, 0, 3, 6}, []int{7, 12, 21}},
+		{QuietHours{From: 23, To: 0}, []int{23}, []int{0, 22}},
+		{QuietHours{From: 5, To: 5}, nil, []int{0, 5, 23}},
+	}
+
+	for _, test := range tests {
+		for _, hour := range test.quiet {
+			if !test.quietHours.contains(hour) {
+				t.Errorf("%s: want %d quiet", test.quietHours, hour)
+			}
+		}
+		for _, hour := range test.loud {
+			if test.quietHours.contains(hour) {
+				t.Errorf("%s: want %d not quiet", test.quietHours, hour)
+			}
+		}
+	}
+}
+
+func TestParseQuietHours(t *testing.T) {
+	for value, want := range map[string]QuietHours{
+		"22-7":        {From: 22, To: 7},
+		"23:00-07:00": {From: 23, To: 7},
+		"0-0":         {},
+	} {
+		if got, err := parseQuietHours(value); err != nil || got != want {
+			t.Errorf("%s: got %+v, %v, want %+v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "22", "22-24", "-1-7", "a-7", "22-b"} {
+		if _, err := parseQuietHours(value); err == nil {
+			t.Errorf("%q: want an error", value)
+		}
+	}
+}
+
+func TestSubscriberIsQuiet(t *testing.T) {
+	setConfig(Config{QuietHours: QuietHours{From: 2, To: 7}})
+
+	from, to := 22, 7
+	tokyo := &Subscriber{Timezone: "Asia/Tokyo", QuietFrom: &from, QuietTo: &to}
+	newYork := &Subscriber{Timezone: "America/New_York"}
+
+	tests := []struct {
+		subscriber *Subscriber
+		now        time.Time
+		quiet      bool
+	}{
+		// 23:00 and 06:59 in Tokyo, UTC+9
+		{tokyo, time.Date(2022, 3, 1, 14, 0, 0, 0, time.UTC), true},
+		{tokyo, time.Date(2022, 3, 1, 21, 59, 0, 0, time.UTC), true},
+		{tokyo, time.Date(2022, 3, 1, 22, 0, 0, 0, time.UTC), false},
+		{tokyo, time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC), false},
+		// the config hours, 02:00 in New York is 07:00 UTC in winter and 06:00 UTC in summer
+		{newYork, time.Date(2022, 3, 1, 7, 0, 0, 0, time.UTC), true},
+		{newYork, time.Date(2022, 3, 1, 6, 0, 0, 0, time.UTC), false},
+		{newYork, time.Date(2022, 7, 1, 6, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, test := range tests {
+		if quiet := test.subscriber.isQuiet(test.now); quiet != test.quiet {
+			t.Errorf("%s at %s: got quiet %v, want %v", test.subscriber.Timezone, test.now, quiet, test.quiet)
+		}
+	}
+}
+
+func TestFormatQuietSummary(t *testing.T) {
+	summary := formatQuietSummary([]QueuedNotification{
+		{Kind: NotificationKindMovers, Notification: "movers 1", Coins: []LoggedCoin{{Code: "BTC", Direction: "up", Value: 5}, {Code: "ETH", Direction: "down", Value: 3}}},
+		{Kind: NotificationKindVolume, Notification: "volume", Coins: []LoggedCoin{{Code: "BTC", Direction: "spike", Value: 2.5}}},
+		{Kind: NotificationKindMovers, Notification: "movers 2", Coins: []LoggedCoin{{Code: "BTC", Direction: "up", Value: 7}}},
+		{Kind: NotificationKindPriceAlert, Notification: "BTC crossed 40000"},
+		{Kind: NotificationKindPriceAlert, Notification: "ETH crossed 3000"},
+		{Kind: NotificationKindConsolidation, Notification: "consolidation 1"},
+		{Kind: NotificationKindConsolidation, Notification: "consolidation 2"},
+	})
+
+	lines := strings.Split(summary, "\n")
+	var rows []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "| ") && !strings.Contains(line, "KIND") {
+			rows = append(rows, strings.Join(strings.Fields(strings.ReplaceAll(line, "|", " ")), " "))
+		}
+	}
+
+	// the biggest move of every coin, by kind and value
+	want := []string{"movers BTC up 7.00%", "movers ETH down 3.00%", "volume BTC 2.50x"}
+	if strings.Join(rows, ";") != strings.Join(want, ";") {
+		t.Errorf("got rows %q, want %q", rows, want)
+	}
+
+	if !strings.Contains(summary, "7 delayed notifications.") {
+		t.Errorf("got %q, want the count of the held notifications", summary)
+	}
+
+	// every price alert and the latest of the other texts
+	for _, text := range []string{"BTC crossed 40000", "ETH crossed 3000", "consolidation 2"} {
+		if !strings.Contains(summary, text) {
+			t.Errorf("got %q, want %q", summary, text)
+		}
+	}
+	if strings.Contains(summary, "consolidation 1") {
+		t.Errorf("got %q, want the older consolidation dropped", summary)
+	}
+}
+
+// TestHeldNotificationsInHistory counts the notifications held by quiet hours in the cooldown.
+func TestHeldNotificationsInHistory(t *testing.T) {
+	testDatabase(t)
+	setConfig(Config{Cooldown: defaultCooldown})
+
+	subscriber, err := (&Subscriber{}).addNew(&tgbotapi.Chat{ID: 70, FirstName: "Quiet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coin := LoggedCoin{Code: "BTC", Direction: "up", Value: 5}
+	queueNotification(subscriber, NotificationKindMovers, "BTC 5%", []LoggedCoin{coin})
+
+	history, err := loadNotificationHistory(NotificationKindMovers, []Subscriber{*subscriber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history.isSent(subscriber.Id, "BTC 5%") || !history.isRepeated(subscriber.Id, coin) {
+		t.Error("want the held notification in the history")
+	}
+
+	// another kind doesn't count
+	if history, _ := loadNotificationHistory(NotificationKindVolume, []Subscriber{*subscriber}); history.isRepeated(subscriber.Id, coin) {
+		t.Error("got the held movers in the volume history")
+	}
+}
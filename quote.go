@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+var defaultQuotes = []string{"BUSD"}
+
+// defaultQuote is the first configured quote asset, used when a subscriber has not chosen one.
+func defaultQuote() string {
+	quotes := getConfig().Quotes
+	if len(quotes) == 0 {
+		return defaultQuotes[0]
+	}
+	return quotes[0]
+}
+
+func isQuote(value string) bool {
+	return containsString(getConfig().Quotes, value)
+}
+
+func pairName(coin string, quote string) string {
+	return coin + "/" + quote
+}
+
+func (s *Subscriber) getQuote() string {
+	if s.Quote != "" && isQuote(s.Quote) {
+		return s.Quote
+	}
+	return defaultQuote()
+}
+
+func (s *Subscriber) updateQuote(quote string) (err error) {
+	s.Quote = quote
+	s.UpdatedAt = time.Now()
+	_, err = dbConnect.Model(s).
+		Set("quote = ?quote").
+		Set("updated_at = ?updated_at").
+		Where("id = ?id").
+		Update()
+
+	return err
+}
+
+// groupSubscribersByQuote keeps the subscribers order within every quote.
+func groupSubscribersByQuote(subscribers []Subscriber) map[string][]*Subscriber {
+	result := make(map[string][]*Subscriber)
+
+	for i := range subscribers {
+		quote := subscribers[i].getQuote()
+		result[quote] = append(result[quote], &subscribers[i])
+	}
+
+	return result
+}
+
+func handleQuoteCommand(subscriber *Subscriber, arguments string) string {
+	quote := strings.ToUpper(strings.TrimSpace(arguments))
+	quotes := strings.Join(getConfig().Quotes, ", ")
+
+	if quote == "" {
+		return "Quote currency: " + subscriber.getQuote() + "\nAvailable: " + quotes
+	}
+
+	if !isQuote(quote) {
+		return "Unknown quote currency " + quote + ", use one of " + quotes
+	}
+
+	if err := subscriber.updateQuote(quote); err != nil {
+		log.Warnf("can't update subscriber quote: %v", err)
+		return "Возникла ошибка №435/8"
+	}
+
+	return "Quote currency: " + quote
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/olekukonko/tablewriter"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// telegramRate and telegramBurst keep under the 30 messages per second of a bot
+	telegramRate  = 25
+	telegramBurst = 5
+	// telegramChatInterval keeps under 1 message per second to a chat
+	telegramChatInterval = time.Second
+	// telegramMaxRetryAfter is the longest 429 retry_after waited inline, a longer one is returned to the caller
+	telegramMaxRetryAfter = 30 * time.Second
+	telegramMaxRetries    = 3
+)
+
+// TelegramLimiter paces all the messages of the bot, a token bucket for the bot and an interval for every chat.
+type TelegramLimiter struct {
+	mutex sync.Mutex
+
+	interval time.Duration
+	// tolerance lets a burst of messages through at once
+	tolerance time.Duration
+	// tat is the theoretical arrival time of the next message
+	tat         time.Time
+	chats       map[int64]time.Time
+	chatGap     time.Duration
+	pausedUntil time.Time
+
+	sent        int64
+	throttled   int64
+	waited      time.Duration
+	tooMany     int64
+	lastTooMany time.Time
+
+	// Now is the clock of the waits and the 429 pauses
+	Now func() time.Time
+}
+
+var telegramLimiter = newTelegramLimiter(telegramRate, telegramBurst, telegramChatInterval)
+
+func newTelegramLimiter(rate int, burst int, chatGap time.Duration) *TelegramLimiter {
+	interval := time.Second / time.Duration(rate)
+
+	return &TelegramLimiter{
+		interval:  interval,
+		tolerance: time.Duration(burst-1) * interval,
+		chats:     make(map[int64]time.Time),
+		chatGap:   chatGap,
+		Now:       time.Now,
+	}
+}
+
+// reserve books the earliest slot for a message to the chat and returns how long to wait for it.
+func (l *TelegramLimiter) reserve(chatId int64, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	at := now
+	if l.pausedUntil.After(at) {
+		at = l.pausedUntil
+	}
+	if earliest := l.tat.Add(-l.tolerance); earliest.After(at) {
+		at = earliest
+	}
+
+	if l.tat.Before(at) {
+		l.tat = at
+	}
+	l.tat = l.tat.Add(l.interval)
+
+	// the chat pacing only delays the message, it doesn't hold the bucket for other chats
+	if next, ok := l.chats[chatId]; ok && next.After(at) {
+		at = next
+	}
+
+	if len(l.chats) > 10000 {
+		for id, next := range l.chats {
+			if next.Before(now) {
+				delete(l.chats, id)
+			}
+		}
+	}
+	l.chats[chatId] = at.Add(l.chatGap)
+
+	wait := at.Sub(now)
+
+	l.sent++
+	if wait > 0 {
+		l.throttled++
+		l.waited += wait
+	}
+
+	return wait
+}
+
+// wait returns ctx.Err() when ctx is done first.
+func (l *TelegramLimiter) wait(ctx context.Context, chatId int64) error {
+	wait := l.reserve(chatId, l.Now())
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause holds all the messages, Telegram doesn't tell whether a 429 is for the chat or for the bot.
+func (l *TelegramLimiter) pause(retryAfter time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.Now()
+	l.tooMany++
+	l.lastTooMany = now
+
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *TelegramLimiter) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	average := time.Duration(0)
+	if l.throttled > 0 {
+		average = l.waited / time.Duration(l.throttled)
+	}
+
+	lastTooMany := "-"
+	if !l.lastTooMany.IsZero() {
+		lastTooMany = l.lastTooMany.Format("01-02 15:04:05")
+	}
+
+	paused := "-"
+	if wait := l.pausedUntil.Sub(l.Now()); wait > 0 {
+		paused = wait.Round(time.Second).String()
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Metric", "Value"})
+	table.SetCaption(true, fmt.Sprintf("Limit %d/s, %s per chat.", time.Second/l.interval, l.chatGap))
+
+	table.Append([]string{"Messages", fmt.Sprint(l.sent)})
+	table.Append([]string{"Throttled", fmt.Sprint(l.throttled)})
+	table.Append([]string{"Waited", l.waited.Round(time.Millisecond).String()})
+	table.Append([]string{"Average wait", average.Round(time.Millisecond).String()})
+	table.Append([]string{"429 responses", fmt.Sprint(l.tooMany)})
+	table.Append([]string{"Last 429", lastTooMany})
+	table.Append([]string{"Paused for", paused})
+
+	table.Render()
+
+	return tableString.String()
+}
+
+// sendTelegram is the only way messages leave the bot, it waits for the limiter and retries on 429
+// until ctx is done.
+func sendTelegram(ctx context.Context, bot *tgbotapi.BotAPI, chatId int64, chattable tgbotapi.Chattable) (tgbotapi.Message, error) {
+	for attempt := 0; ; attempt++ {
+		if err := telegramLimiter.wait(ctx, chatId); err != nil {
+			return tgbotapi.Message{}, err
+		}
+
+		message, err := bot.Send(chattable)
+
+		var apiErr *tgbotapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+			return message, err
+		}
+
+		retryAfter := time.Duration(apiErr.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+
+		telegramLimiter.pause(retryAfter)
+		log.Warnf("telegram 429 for chat %d, retry after %s", chatId, retryAfter)
+
+		if retryAfter > telegramMaxRetryAfter || attempt+1 >= telegramMaxRetries {
+			return message, err
+		}
+	}
+}
+
+func handleRateLimitCommand(subscriber *Subscriber) string {
+	if !isAdmin(subscriber) {
+		return "The command is for admins only"
+	}
+
+	return telegramLimiter.String()
+}
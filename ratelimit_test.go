@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testTelegramLimiter sends 10 messages per second with a burst of 3 and a second between messages to a chat.
+func testTelegramLimiter(now *time.Time) *TelegramLimiter {
+	limiter := newTelegramLimiter(10, 3, time.Second)
+	limiter.Now = func() time.Time {
+		return *now
+	}
+	return limiter
+}
+
+func TestTelegramLimiterReserve(t *testing.T) {
+	start := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	ms := time.Millisecond
+
+	type reservation struct {
+		chatId int64
+		after  time.Duration
+		wait   time.Duration
+	}
+
+	tests := []struct {
+		name         string
+		pause        time.Duration
+		reservations []reservation
+	}{
+		{"burst, then the rate", 0, []reservation{
+			{1, 0, 0}, {2, 0, 0}, {3, 0, 0}, {4, 0, 100 * ms}, {5, 0, 200 * ms},
+			// the bucket drains with time
+			{6, 1000 * ms, 0}, {7, 1000 * ms, 0},
+		}},
+		{"chat gap", 0, []reservation{
+			{1, 0, 0}, {1, 0, 1000 * ms}, {2, 0, 0}, {1, 500 * ms, 1500 * ms},
+			// the wait of a chat doesn't hold the other chats
+			{3, 500 * ms, 0},
+		}},
+		{"pause after a 429", 2 * time.Second, []reservation{
+			{1, 0, 2000 * ms}, {2, 0, 2000 * ms}, {3, 0, 2000 * ms}, {4, 0, 2100 * ms},
+			{1, 1000 * ms, 2000 * ms},
+			{5, 5000 * ms, 0},
+		}},
+	}
+
+	for _, test := range tests {
+		now := start
+		limiter := testTelegramLimiter(&now)
+		if test.pause > 0 {
+			limiter.pause(test.pause)
+			// a shorter pause doesn't cut the longer one
+			limiter.pause(test.pause / 2)
+		}
+
+		for i, reservation := range test.reservations {
+			now = start.Add(reservation.after)
+			if wait := limiter.reserve(reservation.chatId, now); wait != reservation.wait {
+				t.Errorf("%s: reservation %d to chat %d got %s, want %s", test.name, i, reservation.chatId, wait, reservation.wait)
+			}
+		}
+	}
+}
+
+func TestTelegramLimiterWait(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := testTelegramLimiter(&now)
+
+	if err := limiter.wait(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chat gap is a second on the fake clock, the cancel comes first
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.wait(ctx, 1); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+
+	limiter.pause(time.Minute)
+	if limiter.tooMany != 1 || !limiter.lastTooMany.Equal(now) || !limiter.pausedUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("got %d 429s, last %s, paused until %s", limiter.tooMany, limiter.lastTooMany, limiter.pausedUntil)
+	}
+}
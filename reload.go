@@ -0,0 +1,120 @@
+package main
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const configReloadDelay = 500 * time.Millisecond
+
+var (
+	configListenersMutex sync.Mutex
+	configListeners      []func(Config)
+)
+
+// onConfigReload registers a callback run with the new Config after every successful reload.
+func onConfigReload(listener func(Config)) {
+	configListenersMutex.Lock()
+	defer configListenersMutex.Unlock()
+
+	configListeners = append(configListeners, listener)
+}
+
+// reloadConfig re-reads and validates the config, an invalid config keeps the current one.
+// The bot token, the Bot API server and the database can't be changed without a restart.
+func reloadConfig() {
+	config, err := loadConfig(appConfigPath)
+	if err != nil {
+		log.Errorf("config reload rejected: %v", err)
+		return
+	}
+
+	current := getConfig()
+
+	if config.TelegramBot != current.TelegramBot {
+		log.Warn("telegram-bot change requires a restart, keeping the current token")
+		config.TelegramBot = current.TelegramBot
+	}
+
+	if config.TelegramApi != current.TelegramApi {
+		log.Warn("telegram-api change requires a restart, keeping the current server")
+		config.TelegramApi = current.TelegramApi
+	}
+
+	if config.Db != current.Db {
+		log.Warn("db change requires a restart, keeping the current connection")
+		config.Db = current.Db
+	}
+
+	setConfig(config)
+
+	configListenersMutex.Lock()
+	listeners := append([]func(Config){}, configListeners...)
+	configListenersMutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(config)
+	}
+
+	log.Infof("config reloaded from %s", appConfigPath)
+}
+
+// watchConfig reloads the config on SIGHUP and when the config file is written or replaced.
+func watchConfig() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	var events chan fsnotify.Event
+	var watchErrors chan error
+
+	path, err := filepath.Abs(appConfigPath)
+	if err != nil {
+		path = appConfigPath
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warnf("can't watch config file, reload with SIGHUP: %v", err)
+	} else {
+		defer watcher.Close()
+
+		// editors replace the file, so the directory is watched instead
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			log.Warnf("can't watch config file, reload with SIGHUP: %v", err)
+		} else {
+			events = watcher.Events
+			watchErrors = watcher.Errors
+		}
+	}
+
+	var delay <-chan time.Time
+
+	for {
+		select {
+		case <-hangup:
+			reloadConfig()
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(event.Name) == path && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				delay = time.After(configReloadDelay)
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			log.Warnf("config watcher: %v", err)
+		case <-delay:
+			delay = nil
+			reloadConfig()
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var errCoinNotFound = errors.New("coin not found")
+
+// MarketDataRepository is the read side of klines, coins and coins_pairs used by the notifications,
+// every query is limited to the pairs with the given quote asset.
+type MarketDataRepository interface {
+	// WithContext is the repository running its queries with ctx, the jobs stop the queries on shutdown
+	WithContext(ctx context.Context) MarketDataRepository
+	GetPercentCoins(quote string, codes ...string) ([]PercentCoinShort, error)
+	GetConsolidationPeriodCoins(quote string) ([]ConsolidationPeriodCoin, error)
+	GetExchangeRate(coin string, quote string) (*PercentCoin, error)
+	GetKlines(coin string, quote string, interval ChartInterval) ([]Kline, error)
+	GetVolumeSpikes(quote string) ([]VolumeSpike, error)
+	GetLatestPrices(quote string, codes []string) (map[string]CoinPrice, error)
+	CoinExists(code string, quote string) (bool, error)
+}
+
+var marketData MarketDataRepository
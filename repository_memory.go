@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// MemoryCoin is one coins pair, a coin traded against several quotes is listed once per quote.
+type MemoryCoin struct {
+	Id     int64
+	Code   string
+	Quote  string
+	Rank   int
+	Klines []Kline
+}
+
+// MemoryMarketData answers MarketDataRepository queries from klines held in memory, relative to Now.
+type MemoryMarketData struct {
+	Coins []MemoryCoin
+	Now   func() time.Time
+}
+
+func newMemoryMarketData(coins []MemoryCoin) *MemoryMarketData {
+	for i := range coins {
+		sort.Slice(coins[i].Klines, func(a, b int) bool {
+			return coins[i].Klines[a].OpenTime.Before(coins[i].Klines[b].OpenTime)
+		})
+	}
+
+	return &MemoryMarketData{Coins: coins, Now: time.Now}
+}
+
+// loadMemoryMarketData reads a kline fixture file, the clock is frozen at the last kline close time.
+func loadMemoryMarketData(path string) (*MemoryMarketData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var fixtures struct {
+		Coins []MemoryCoin
+	}
+
+	if err := json.NewDecoder(file).Decode(&fixtures); err != nil {
+		return nil, err
+	}
+
+	repository := newMemoryMarketData(fixtures.Coins)
+
+	var now time.Time
+	for _, coin := range repository.Coins {
+		for _, kline := range coin.Klines {
+			if kline.CloseTime.After(now) {
+				now = kline.CloseTime
+			}
+		}
+	}
+
+	repository.Now = func() time.Time {
+		return now
+	}
+
+	return repository, nil
+}
+
+// WithContext keeps the repository, the klines in memory are read at once.
+func (r *MemoryMarketData) WithContext(ctx context.Context) MarketDataRepository {
+	return r
+}
+
+func (r *MemoryMarketData) findCoin(code string, quote string) (*MemoryCoin, bool) {
+	for i := range r.Coins {
+		if r.Coins[i].Code == code && r.Coins[i].Quote == quote {
+			return &r.Coins[i], true
+		}
+	}
+	return nil, false
+}
+
+func (r *MemoryMarketData) klinesSince(coin *MemoryCoin, since time.Time) []Kline {
+	var klines []Kline
+
+	for _, kline := range coin.Klines {
+		if !kline.OpenTime.Before(since) {
+			klines = append(klines, kline)
+		}
+	}
+
+	return klines
+}
+
+func (r *MemoryMarketData) lastDay(coin *MemoryCoin) coinKlines {
+	return coinKlines{
+		CoinId: coin.Id,
+		Code:   coin.Code,
+		Rank:   coin.Rank,
+		Klines: r.klinesSince(coin, r.Now().Add(-24*time.Hour)),
+	}
+}
+
+func (r *MemoryMarketData) GetPercentCoins(quote string, codes ...string) ([]PercentCoinShort, error) {
+	var coins []coinStats
+
+	for i := range r.Coins {
+		if r.Coins[i].Quote != quote {
+			continue
+		}
+		if len(codes) > 0 && !containsString(codes, r.Coins[i].Code) {
+			continue
+		}
+		coins = append(coins, moverWindows.stats(r.lastDay(&r.Coins[i]), r.Now()))
+	}
+
+	return calcPercentCoins(coins), nil
+}
+
+func (r *MemoryMarketData) GetConsolidationPeriodCoins(quote string) ([]ConsolidationPeriodCoin, error) {
+	now := r.Now()
+	since := now.Add(-14 * 24 * time.Hour).Truncate(time.Hour)
+
+	var result []ConsolidationPeriodCoin
+
+	for i := range r.Coins {
+		coin := &r.Coins[i]
+
+		if coin.Quote != quote || len(coin.Klines) == 0 {
+			continue
+		}
+
+		type day struct {
+			open, close float64
+			count       int
+		}
+
+		days := make(map[time.Time]*day)
+		for _, kline := range r.klinesSince(coin, since) {
+			key := kline.OpenTime.Truncate(24 * time.Hour)
+			if days[key] == nil {
+				days[key] = &day{}
+			}
+			days[key].open += kline.Open
+			days[key].close += kline.Close
+			days[key].count++
+		}
+
+		if len(days) == 0 {
+			continue
+		}
+
+		item := ConsolidationPeriodCoin{
+			CoinId: coin.Id,
+			Rank:   coin.Rank,
+			Code:   coin.Code,
+			Price:  coin.Klines[len(coin.Klines)-1].Close,
+		}
+
+		for _, d := range days {
+			item.AvgOpen += d.open / float64(d.count)
+			item.AvgClose += d.close / float64(d.count)
+		}
+		item.AvgOpen /= float64(len(days))
+		item.AvgClose /= float64(len(days))
+		item.PercentOpen = calcPercent(item.AvgOpen, item.Price)
+		item.PercentClose = calcPercent(item.AvgClose, item.Price)
+
+		if item.PercentOpen >= -3 && item.PercentOpen <= 5 && item.PercentClose >= -3 && item.PercentClose <= 5 {
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *MemoryMarketData) GetExchangeRate(code string, quote string) (*PercentCoin, error) {
+	coin, ok := r.findCoin(code, quote)
+	if !ok {
+		return nil, errCoinNotFound
+	}
+
+	klines := r.lastDay(coin)
+	if len(klines.Klines) == 0 {
+		return nil, errCoinNotFound
+	}
+
+	rate := calcPercentCoin(rateWindows.stats(klines, r.Now()))
+
+	return &rate, nil
+}
+
+func (r *MemoryMarketData) GetKlines(code string, quote string, interval ChartInterval) ([]Kline, error) {
+	coin, ok := r.findCoin(code, quote)
+	if !ok {
+		return nil, nil
+	}
+
+	klines := r.klinesSince(coin, r.Now().Add(-interval.Range))
+
+	if interval.Bucket == 0 {
+		return klines, nil
+	}
+
+	var result []Kline
+
+	for _, kline := range klines {
+		openTime := kline.OpenTime.Truncate(interval.Bucket)
+
+		if len(result) == 0 || !result[len(result)-1].OpenTime.Equal(openTime) {
+			kline.OpenTime = openTime
+			result = append(result, kline)
+			continue
+		}
+
+		bucket := &result[len(result)-1]
+		bucket.CloseTime = kline.CloseTime
+		bucket.High = math.Max(bucket.High, kline.High)
+		bucket.Low = math.Min(bucket.Low, kline.Low)
+		bucket.Close = kline.Close
+		bucket.Volume += kline.Volume
+		bucket.QuoteAssetVolume += kline.QuoteAssetVolume
+		bucket.TradeNum += kline.TradeNum
+	}
+
+	return result, nil
+}
+
+func (r *MemoryMarketData) GetVolumeSpikes(quote string) ([]VolumeSpike, error) {
+	now := r.Now()
+	recentSince := now.Add(-time.Hour)
+	baselineSince := now.Add(-25 * time.Hour)
+
+	var result []VolumeSpike
+
+	for i := range r.Coins {
+		coin := &r.Coins[i]
+		if coin.Quote != quote {
+			continue
+		}
+
+		spike := VolumeSpike{Code: coin.Code, Rank: coin.Rank}
+
+		for _, kline := range r.klinesSince(coin, baselineSince) {
+			if kline.OpenTime.Before(recentSince) {
+				spike.BaselineQuoteVolume += kline.QuoteAssetVolume
+				spike.BaselineTradeNum += float64(kline.TradeNum)
+				continue
+			}
+			spike.CoinPairId = kline.CoinPairId
+			spike.QuoteVolume += kline.QuoteAssetVolume
+			spike.TradeNum += float64(kline.TradeNum)
+		}
+
+		spike.BaselineQuoteVolume /= 24
+		spike.BaselineTradeNum /= 24
+
+		if spike.BaselineQuoteVolume <= 0 || spike.QuoteVolume == 0 {
+			continue
+		}
+
+		spike.VolumeRatio = spike.QuoteVolume / spike.BaselineQuoteVolume
+		if spike.BaselineTradeNum > 0 {
+			spike.TradeRatio = spike.TradeNum / spike.BaselineTradeNum
+		}
+
+		result = append(result, spike)
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].VolumeRatio > result[b].VolumeRatio
+	})
+
+	return result, nil
+}
+
+func (r *MemoryMarketData) GetLatestPrices(quote string, codes []string) (map[string]CoinPrice, error) {
+	result := make(map[string]CoinPrice)
+
+	for _, code := range codes {
+		coin, ok := r.findCoin(code, quote)
+		if !ok {
+			continue
+		}
+
+		klines := r.klinesSince(coin, r.Now().Add(-24*time.Hour))
+		if len(klines) == 0 {
+			continue
+		}
+
+		last := klines[len(klines)-1]
+		result[code] = CoinPrice{Code: code, Close: last.Close, CloseTime: last.CloseTime}
+	}
+
+	return result, nil
+}
+
+func (r *MemoryMarketData) CoinExists(code string, quote string) (bool, error) {
+	_, ok := r.findCoin(code, quote)
+	return ok, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestMemoryMarketDataMovers(t *testing.T) {
+	repository, err := loadMemoryMarketData("testdata/klines.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if now := repository.Now(); !now.Equal(time.Date(2022, 3, 1, 11, 59, 59, 999000000, time.UTC)) {
+		t.Fatalf("got clock %s, want the last close time", now)
+	}
+
+	coins, err := repository.GetPercentCoins("BUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the windows start at 11:40, 10:00, 07:00, 23:00 and 24 hours before the clock
+	want := []PercentCoinShort{
+		{CoinId: 2, Code: "ETH", Minute10: 0.164457259836, Hour: 2.132215837136, Hour4: 2.483093761774, Hour12: 6.999156607629, Hour24: 12.324850571817, PercentSum: 24.104},
+		{CoinId: 1, Code: "BTC", Minute10: 0.104467471488, Hour: 1.644438824045, Hour4: 1.262232267472, Hour12: 3.715155670425, Hour24: 6.043103206379, PercentSum: 12.769},
+	}
+
+	if len(coins) != len(want) {
+		t.Fatalf("got %d coins, want %d", len(coins), len(want))
+	}
+	for i, coin := range coins {
+		if coin.Code != want[i].Code || coin.CoinId != want[i].CoinId || coin.PercentSum != want[i].PercentSum ||
+			!almostEqual(coin.Minute10, want[i].Minute10) || !almostEqual(coin.Hour, want[i].Hour) ||
+			!almostEqual(coin.Hour4, want[i].Hour4) || !almostEqual(coin.Hour12, want[i].Hour12) ||
+			!almostEqual(coin.Hour24, want[i].Hour24) {
+			t.Errorf("coin %d: got %+v, want %+v", i, coin, want[i])
+		}
+	}
+
+	if coins, _ := repository.GetPercentCoins("BUSD", "BTC"); len(coins) != 1 || coins[0].Code != "BTC" {
+		t.Errorf("got %+v, want BTC only", coins)
+	}
+	if coins, _ := repository.GetPercentCoins("USDT"); len(coins) != 0 {
+		t.Errorf("got %+v for a quote without coins", coins)
+	}
+
+	rate, err := repository.GetExchangeRate("BTC", "BUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.HourMinOpen != 42385.28 || rate.HourMaxClose != 43082.28 {
+		t.Errorf("got hour %v-%v, want 42385.28-43082.28", rate.HourMinOpen, rate.HourMaxClose)
+	}
+	if _, err := repository.GetExchangeRate("XRP", "BUSD"); err != errCoinNotFound {
+		t.Errorf("got %v, want errCoinNotFound", err)
+	}
+}
+
+func TestMemoryMarketDataKlines(t *testing.T) {
+	repository, err := loadMemoryMarketData("testdata/klines.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{"1h": 4, "12h": 48, "1d": 96, "7d": 26, "30d": 7}
+	for name, count := range counts {
+		interval, _ := getChartInterval(name)
+
+		klines, err := repository.GetKlines("BTC", "BUSD", interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(klines) != count {
+			t.Errorf("%s: got %d klines, want %d", name, len(klines), count)
+		}
+	}
+
+	// the first hour of the fixture in one candle
+	interval, _ := getChartInterval("7d")
+	klines, _ := repository.GetKlines("BTC", "BUSD", interval)
+	first := klines[0]
+	if !first.OpenTime.Equal(time.Date(2022, 2, 28, 10, 0, 0, 0, time.UTC)) ||
+		!first.CloseTime.Equal(time.Date(2022, 2, 28, 10, 59, 59, 999000000, time.UTC)) {
+		t.Errorf("got candle %s - %s", first.OpenTime, first.CloseTime)
+	}
+	if first.Open != 40000 || first.Close != 40239.48 || first.High != 40279.72 || first.Low != 39960 ||
+		first.Volume != 460 || first.TradeNum != 1380 {
+		t.Errorf("got candle %+v", first)
+	}
+
+	if klines, _ := repository.GetKlines("XRP", "BUSD", interval); len(klines) != 0 {
+		t.Errorf("got %d klines of an unknown coin", len(klines))
+	}
+}
+
+func TestMemoryMarketDataLatestPrices(t *testing.T) {
+	repository, err := loadMemoryMarketData("testdata/klines.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices, err := repository.GetLatestPrices("BUSD", []string{"BTC", "ETH", "XRP"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(prices) != 2 || prices["BTC"].Close != 43082.28 || prices["ETH"].Close != 3209.75 {
+		t.Errorf("got prices %+v", prices)
+	}
+	if !prices["BTC"].CloseTime.Equal(repository.Now()) {
+		t.Errorf("got close time %s", prices["BTC"].CloseTime)
+	}
+
+	// a day later the prices are stale
+	now := repository.Now().Add(25 * time.Hour)
+	repository.Now = func() time.Time {
+		return now
+	}
+	if prices, _ := repository.GetLatestPrices("BUSD", []string{"BTC"}); len(prices) != 0 {
+		t.Errorf("got stale prices %+v", prices)
+	}
+}
+
+// TestMemoryMarketDataMatchesPostgres loads the fixture into the loader tables and compares both repositories
+// at the fixture clock.
+func TestMemoryMarketDataMatchesPostgres(t *testing.T) {
+	testDatabase(t)
+
+	memory, err := loadMemoryMarketData("testdata/klines.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dbConnect.Exec(`TRUNCATE klines, coins_pairs, coins RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	for _, coin := range memory.Coins {
+		if _, err := dbConnect.Exec(`INSERT INTO coins (id, code, rank) VALUES (?, ?, ?)`, coin.Id, coin.Code, coin.Rank); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dbConnect.Exec(`INSERT INTO coins_pairs (id, coin_id, couple) VALUES (?, ?, ?)`,
+			coin.Klines[0].CoinPairId, coin.Id, coin.Quote); err != nil {
+			t.Fatal(err)
+		}
+		klines := coin.Klines
+		if _, err := dbConnect.Model(&klines).Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	postgres := newPostgresMarketData(&dbConnect)
+	postgres.Now = memory.Now
+
+	memoryCoins, _ := memory.GetPercentCoins("BUSD")
+	postgresCoins, err := postgres.GetPercentCoins("BUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memoryCoins) != len(postgresCoins) {
+		t.Fatalf("got %d movers in memory, %d in postgres", len(memoryCoins), len(postgresCoins))
+	}
+	for i := range memoryCoins {
+		a, b := memoryCoins[i], postgresCoins[i]
+		if a.Code != b.Code || a.PercentSum != b.PercentSum || !almostEqual(a.Minute10, b.Minute10) || !almostEqual(a.Hour24, b.Hour24) {
+			t.Errorf("mover %d: got %+v in memory, %+v in postgres", i, a, b)
+		}
+	}
+
+	memoryRate, _ := memory.GetExchangeRate("ETH", "BUSD")
+	postgresRate, err := postgres.GetExchangeRate("ETH", "BUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *memoryRate != *postgresRate {
+		t.Errorf("got rate %+v in memory, %+v in postgres", memoryRate, postgresRate)
+	}
+
+	for _, interval := range chartIntervals {
+		memoryKlines, _ := memory.GetKlines("BTC", "BUSD", interval)
+		postgresKlines, err := postgres.GetKlines("BTC", "BUSD", interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(memoryKlines) != len(postgresKlines) {
+			t.Errorf("%s: got %d klines in memory, %d in postgres", interval.Name, len(memoryKlines), len(postgresKlines))
+			continue
+		}
+		for i := range memoryKlines {
+			a, b := memoryKlines[i], postgresKlines[i]
+			if !a.OpenTime.Equal(b.OpenTime) || !a.CloseTime.Equal(b.CloseTime) || a.Open != b.Open || a.Close != b.Close ||
+				a.High != b.High || a.Low != b.Low || !almostEqual(a.Volume, b.Volume) || a.TradeNum != b.TradeNum {
+				t.Errorf("%s kline %d: got %+v in memory, %+v in postgres", interval.Name, i, a, b)
+				break
+			}
+		}
+	}
+
+	codes := []string{"BTC", "ETH", "XRP"}
+	memoryPrices, _ := memory.GetLatestPrices("BUSD", codes)
+	postgresPrices, err := postgres.GetLatestPrices("BUSD", codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(memoryPrices) != len(postgresPrices) {
+		t.Fatalf("got prices %+v in memory, %+v in postgres", memoryPrices, postgresPrices)
+	}
+	for code, price := range memoryPrices {
+		if price.Close != postgresPrices[code].Close || !price.CloseTime.Equal(postgresPrices[code].CloseTime) {
+			t.Errorf("%s: got %+v in memory, %+v in postgres", code, price, postgresPrices[code])
+		}
+	}
+}
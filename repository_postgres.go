@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"time"
+)
+
+// PostgresMarketData answers MarketDataRepository queries from the loader tables, relative to Now.
+type PostgresMarketData struct {
+	db  *pg.DB
+	Now func() time.Time
+}
+
+func newPostgresMarketData(db *pg.DB) *PostgresMarketData {
+	return &PostgresMarketData{db: db, Now: time.Now}
+}
+
+func (r *PostgresMarketData) WithContext(ctx context.Context) MarketDataRepository {
+	return &PostgresMarketData{db: r.db.WithContext(ctx), Now: r.Now}
+}
+
+type coinKline struct {
+	CoinId    int64
+	Code      string
+	Rank      int
+	OpenTime  time.Time
+	CloseTime time.Time
+	Open      float64
+	Close     float64
+}
+
+// getWindowStats loads the klines of the enabled coins since the longest window, the stats are computed in Go
+// by percentWindows, the same code as the memory repository.
+func (r *PostgresMarketData) getWindowStats(quote string, windows percentWindows, now time.Time, codes ...string) ([]coinStats, error) {
+	var rows []coinKline
+	params := []interface{}{quote, windows.earliest(now)}
+	codesCondition := ""
+
+	if len(codes) > 0 {
+		codesCondition = "AND c.code IN (?)"
+		params = append(params, pg.In(codes))
+	}
+
+	_, err := r.db.Query(&rows, `
+SELECT c.id AS coin_id, c.code, c.rank, k.open_time, k.close_time, k.open, k.close
+FROM klines AS k
+         INNER JOIN coins_pairs AS cp ON cp.id = k.coin_pair_id
+         INNER JOIN coins AS c ON c.id = cp.coin_id
+WHERE cp.couple = ? AND c.is_enabled = 1 AND cp.is_enabled = 1 AND k.open_time >= ? `+codesCondition+`
+ORDER BY c.id, k.open_time
+`, params...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var klines []coinKlines
+	for _, row := range rows {
+		if len(klines) == 0 || klines[len(klines)-1].CoinId != row.CoinId {
+			klines = append(klines, coinKlines{CoinId: row.CoinId, Code: row.Code, Rank: row.Rank})
+		}
+		coin := &klines[len(klines)-1]
+		coin.Klines = append(coin.Klines, Kline{OpenTime: row.OpenTime, CloseTime: row.CloseTime, Open: row.Open, Close: row.Close})
+	}
+
+	coins := make([]coinStats, 0, len(klines))
+	for _, coin := range klines {
+		coins = append(coins, windows.stats(coin, now))
+	}
+
+	return coins, nil
+}
+
+func (r *PostgresMarketData) GetPercentCoins(quote string, codes ...string) ([]PercentCoinShort, error) {
+	coins, err := r.getWindowStats(quote, moverWindows, r.Now(), codes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return calcPercentCoins(coins), nil
+}
+
+func (r *PostgresMarketData) GetConsolidationPeriodCoins(quote string) ([]ConsolidationPeriodCoin, error) {
+	var coins []ConsolidationPeriodCoin
+	_, err := r.db.Query(&coins, `
+
+WITH coins_last_prices AS (
+    SELECT DISTINCT ON (k.coin_pair_id) k.coin_pair_id, c.id AS coin_id, k.close
+    FROM klines AS k
+             INNER JOIN coins_pairs AS cp ON cp.id = k.coin_pair_id
+             INNER JOIN coins AS c ON c.id = cp.coin_id
+    WHERE cp.couple = ?0
+      AND c.is_enabled = 1
+      AND cp.is_enabled = 1
+    ORDER BY k.coin_pair_id, k.close_time DESC
+)
+
+SELECT t.*
+FROM (
+         SELECT c.id AS coin_id, c.code, c.rank, avg(k.open) AS avg_open, avg(k.close) AS avg_close,
+                clp.close AS price, CAlC_PERCENT(avg(k.open),clp.close) AS percent_open,
+                 CAlC_PERCENT(avg(k.close),clp.close) AS percent_close --array_agg(k.open) AS opens,
+         FROM coins AS c
+                  INNER JOIN coins_pairs cp on cp.coin_id = c.id
+                  LEFT JOIN (
+             SELECT date_trunc('day', k.open_time) AS day,
+                    k.coin_pair_id,
+                    AVG(k.open)                    AS open,
+                    AVG(k.close)                   AS close
+             FROM klines AS k
+             WHERE k.open_time >= date_round_down(?1::timestamptz - interval '14 DAY', '1 HOUR')
+             GROUP BY day, k.coin_pair_id
+             ORDER BY day DESC
+         ) AS k on cp.id = k.coin_pair_id
+			LEFT JOIN coins_last_prices AS clp ON clp.coin_id = c.id
+         WHERE c.is_enabled = 1 AND cp.is_enabled = 1 AND cp.couple = ?0
+         GROUP BY c.id, c.code, clp.close
+     ) AS t
+WHERE (percent_open >=-3 AND percent_open <= 5) AND (percent_close >=-3 AND percent_close <= 5);
+`, quote, r.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return coins, nil
+}
+
+func (r *PostgresMarketData) GetExchangeRate(coin string, quote string) (*PercentCoin, error) {
+	coins, err := r.getWindowStats(quote, rateWindows, r.Now(), coin)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(coins) == 0 {
+		return nil, errCoinNotFound
+	}
+
+	rate := calcPercentCoin(coins[0])
+
+	return &rate, nil
+}
+
+func (r *PostgresMarketData) GetKlines(coin string, quote string, interval ChartInterval) ([]Kline, error) {
+	var klines []Kline
+	var err error
+
+	if interval.Bucket == 0 {
+		_, err = r.db.Query(&klines, `
+SELECT klines.*
+FROM klines
+INNER JOIN coins_pairs cp on klines.coin_pair_id = cp.id
+INNER JOIN coins c on c.id = cp.coin_id
+WHERE open_time >= (?3::timestamptz - interval '1 SECOND' * ?0)
+ AND cp.couple = ?2
+ AND c.code = ?1
+ORDER BY open_time ASC;
+`, int(interval.Range.Seconds()), coin, quote, r.Now())
+	} else {
+		_, err = r.db.Query(&klines, `
+SELECT to_timestamp(floor(extract(EPOCH FROM k.open_time) / ?2) * ?2) AS open_time,
+       MAX(k.close_time)                                              AS close_time,
+       (array_agg(k.open ORDER BY k.open_time ASC))[1]                AS open,
+       MAX(k.high)                                                    AS high,
+       MIN(k.low)                                                     AS low,
+       (array_agg(k.close ORDER BY k.open_time DESC))[1]              AS close,
+       SUM(k.volume)                                                  AS volume,
+       SUM(k.quote_asset_volume)                                      AS quote_asset_volume,
+       SUM(k.trade_num)                                               AS trade_num
+FROM klines AS k
+INNER JOIN coins_pairs cp on k.coin_pair_id = cp.id
+INNER JOIN coins c on c.id = cp.coin_id
+WHERE k.open_time >= (?4::timestamptz - interval '1 SECOND' * ?0)
+ AND cp.couple = ?3
+ AND c.code = ?1
+GROUP BY 1
+ORDER BY 1 ASC;
+`, int(interval.Range.Seconds()), coin, int(interval.Bucket.Seconds()), quote, r.Now())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return klines, nil
+}
+
+func (r *PostgresMarketData) GetVolumeSpikes(quote string) ([]VolumeSpike, error) {
+	var spikes []VolumeSpike
+	_, err := r.db.Query(&spikes, `
+
+WITH pairs AS (
+    SELECT cp.id AS coin_pair_id, c.code, c.rank
+    FROM coins_pairs AS cp
+             INNER JOIN coins AS c ON c.id = cp.coin_id
+    WHERE cp.couple = ?0 AND c.is_enabled = 1 AND cp.is_enabled = 1
+), recent AS (
+    SELECT k.coin_pair_id, SUM(k.quote_asset_volume) AS quote_volume, SUM(k.trade_num) AS trade_num
+    FROM klines AS k
+    WHERE k.open_time >= ?1::timestamptz - INTERVAL '1 HOUR'
+    GROUP BY k.coin_pair_id
+), baseline AS (
+    SELECT k.coin_pair_id, SUM(k.quote_asset_volume) / 24 AS quote_volume, SUM(k.trade_num) / 24.0 AS trade_num
+    FROM klines AS k
+    WHERE k.open_time >= ?1::timestamptz - INTERVAL '25 HOUR'
+      AND k.open_time < ?1::timestamptz - INTERVAL '1 HOUR'
+    GROUP BY k.coin_pair_id
+)
+
+SELECT p.coin_pair_id,
+       p.code,
+       p.rank,
+       r.quote_volume,
+       b.quote_volume                      AS baseline_quote_volume,
+       r.trade_num,
+       b.trade_num                         AS baseline_trade_num,
+       r.quote_volume / b.quote_volume     AS volume_ratio,
+       r.trade_num / NULLIF(b.trade_num, 0) AS trade_ratio
+FROM pairs AS p
+         INNER JOIN recent AS r ON r.coin_pair_id = p.coin_pair_id
+         INNER JOIN baseline AS b ON b.coin_pair_id = p.coin_pair_id
+WHERE b.quote_volume > 0
+ORDER BY volume_ratio DESC;
+`, quote, r.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return spikes, nil
+}
+
+func (r *PostgresMarketData) GetLatestPrices(quote string, codes []string) (map[string]CoinPrice, error) {
+	var prices []CoinPrice
+	_, err := r.db.Query(&prices, `
+SELECT DISTINCT ON (c.code) c.code, k.close, k.close_time
+FROM klines AS k
+         INNER JOIN coins_pairs AS cp ON cp.id = k.coin_pair_id
+         INNER JOIN coins AS c ON c.id = cp.coin_id
+WHERE cp.couple = ?
+  AND c.is_enabled = 1
+  AND cp.is_enabled = 1
+  AND k.open_time >= ?::timestamptz - INTERVAL '1 DAY'
+  AND c.code IN (?)
+ORDER BY c.code, k.open_time DESC
+`, quote, r.Now(), pg.In(codes))
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]CoinPrice, len(prices))
+	for _, price := range prices {
+		result[price.Code] = price
+	}
+
+	return result, nil
+}
+
+func (r *PostgresMarketData) CoinExists(code string, quote string) (bool, error) {
+	var exists bool
+	_, err := r.db.QueryOne(pg.Scan(&exists), `
+SELECT EXISTS(
+    SELECT 1
+    FROM coins AS c
+             INNER JOIN coins_pairs AS cp ON cp.coin_id = c.id
+    WHERE c.code = ? AND cp.couple = ? AND c.is_enabled = 1 AND cp.is_enabled = 1
+)`, code, quote)
+
+	return exists, err
+}
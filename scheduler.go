@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JobMovers        = "movers"
+	JobVolume        = "volume"
+	JobConsolidation = "consolidation"
+	JobPriceAlerts   = "price-alerts"
+	JobQuietSummary  = "quiet-summary"
+)
+
+const (
+	// MissedSkip drops the runs missed while the bot was down or late by more than missedRunGrace
+	MissedSkip = "skip"
+	// MissedRunOnce makes up all the missed runs with a single run
+	MissedRunOnce = "run-once"
+)
+
+const missedRunGrace = time.Minute
+
+var jobNames = []string{JobMovers, JobVolume, JobConsolidation, JobPriceAlerts, JobQuietSummary}
+
+var defaultJobs = []JobConfig{
+	{Name: JobMovers, Schedule: "0,30 * * * *", Missed: MissedSkip, Timeout: "10m"},
+	{Name: JobVolume, Schedule: "0,30 * * * *", Missed: MissedSkip, Timeout: "10m"},
+	{Name: JobConsolidation, Schedule: "0 10 * * *", Missed: MissedRunOnce, Timeout: "30m"},
+	{Name: JobPriceAlerts, Schedule: "* * * * *", Missed: MissedSkip, Timeout: "1m"},
+	{Name: JobQuietSummary, Schedule: "*/5 * * * *", Missed: MissedSkip, Timeout: "5m"},
+}
+
+type JobConfig struct {
+	Name     string
+	Schedule string
+	Missed   string
+	// Timeout cancels the context of the run, /jobs shows the runs over it.
+	Timeout  string
+	Disabled bool
+}
+
+type SchedulerRun struct {
+	tableName struct{} `pg:"scheduler_runs"`
+
+	Job       string    `pg:",pk"`
+	LastRunAt time.Time `pg:",last_run_at"`
+}
+
+// mergeJobs overrides the default jobs by name, so the config may list only the changed ones.
+func mergeJobs(defaults []JobConfig, jobs []JobConfig) []JobConfig {
+	result := append([]JobConfig{}, defaults...)
+
+	for _, job := range jobs {
+		found := false
+
+		for i := range result {
+			if result[i].Name != job.Name {
+				continue
+			}
+
+			if job.Schedule != "" {
+				result[i].Schedule = job.Schedule
+			}
+			if job.Missed != "" {
+				result[i].Missed = job.Missed
+			}
+			if job.Timeout != "" {
+				result[i].Timeout = job.Timeout
+			}
+			result[i].Disabled = job.Disabled
+			found = true
+		}
+
+		if !found {
+			result = append(result, job)
+		}
+	}
+
+	return result
+}
+
+func validateJobs(jobs []JobConfig) []string {
+	var problems []string
+
+	for _, job := range jobs {
+		if !containsString(jobNames, job.Name) {
+			problems = append(problems, "jobs: unknown job "+job.Name+", use "+strings.Join(jobNames, ", "))
+			continue
+		}
+
+		if _, err := parseCron(job.Schedule); err != nil {
+			problems = append(problems, "jobs."+job.Name+": "+err.Error())
+		}
+
+		if job.Missed != MissedSkip && job.Missed != MissedRunOnce {
+			problems = append(problems, "jobs."+job.Name+": missed must be "+MissedSkip+" or "+MissedRunOnce)
+		}
+
+		if timeout, err := time.ParseDuration(job.Timeout); err != nil || timeout <= 0 {
+			problems = append(problems, "jobs."+job.Name+": timeout must be a positive duration like 90s or 10m")
+		}
+	}
+
+	return problems
+}
+
+type scheduledJob struct {
+	config   JobConfig
+	schedule *CronSchedule
+	run      func(ctx context.Context)
+	timeout  time.Duration
+	next     time.Time
+	lastRun  time.Time
+	// running is the in-process lock of the job, startedAt is set with it
+	running   bool
+	startedAt time.Time
+}
+
+type Scheduler struct {
+	mutex   sync.Mutex
+	runners map[string]func(ctx context.Context)
+	jobs    []*scheduledJob
+	wake    chan struct{}
+
+	// inFlight counts the running jobs, jobsContext is cancelled when they don't finish before the shutdown timeout
+	inFlight    sync.WaitGroup
+	jobsContext context.Context
+	cancelJobs  context.CancelFunc
+
+	// loadRuns and saveRun keep the last runs in scheduler_runs
+	loadRuns func() (map[string]time.Time, error)
+	saveRun  func(job string, at time.Time) error
+}
+
+var scheduler *Scheduler
+
+func newScheduler(runners map[string]func(ctx context.Context)) *Scheduler {
+	jobsContext, cancelJobs := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		runners:     runners,
+		wake:        make(chan struct{}, 1),
+		jobsContext: jobsContext,
+		cancelJobs:  cancelJobs,
+		loadRuns:    getSchedulerRuns,
+		saveRun:     saveSchedulerRun,
+	}
+}
+
+// reload replaces the job list, the kept jobs are updated in place, so a running one clears its own flag.
+func (s *Scheduler) reload(configs []JobConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := make(map[string]*scheduledJob, len(s.jobs))
+	for _, job := range s.jobs {
+		previous[job.config.Name] = job
+	}
+
+	now := time.Now()
+	var jobs []*scheduledJob
+
+	for _, config := range configs {
+		run, ok := s.runners[config.Name]
+		if !ok || config.Disabled {
+			continue
+		}
+
+		schedule, err := parseCron(config.Schedule)
+		if err != nil {
+			log.Warnf("job %s: %v", config.Name, err)
+			continue
+		}
+
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			log.Warnf("job %s: %v", config.Name, err)
+			continue
+		}
+
+		job, ok := previous[config.Name]
+		if !ok {
+			job = &scheduledJob{}
+		}
+		job.config = config
+		job.schedule = schedule
+		job.run = run
+		job.timeout = timeout
+		job.next = schedule.Next(now)
+
+		jobs = append(jobs, job)
+	}
+
+	s.jobs = jobs
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// catchUp runs once the run-once jobs that missed a run since the last recorded one.
+func (s *Scheduler) catchUp() {
+	lastRuns, err := s.loadRuns()
+	if err != nil {
+		log.Warnf("can't get scheduler runs: %v", err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	for _, job := range s.jobs {
+		lastRun, ok := lastRuns[job.config.Name]
+		if !ok {
+			continue
+		}
+
+		job.lastRun = lastRun
+
+		missed := job.schedule.Next(lastRun)
+		if job.config.Missed == MissedRunOnce && !missed.IsZero() && missed.Before(now) {
+			log.Infof("job %s missed the run at %s, running now", job.config.Name, missed.Format("2006-01-02 15:04"))
+			s.start(job, now)
+		}
+	}
+}
+
+// run starts the jobs on schedule until ctx is done, the running jobs are left to shutdown.
+func (s *Scheduler) run(ctx context.Context) {
+	s.catchUp()
+
+	for {
+		s.mutex.Lock()
+		var next time.Time
+		for _, job := range s.jobs {
+			if !job.next.IsZero() && (next.IsZero() || job.next.Before(next)) {
+				next = job.next
+			}
+		}
+		s.mutex.Unlock()
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+			s.runDue(time.Now())
+		case <-s.wake:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (s *Scheduler) runDue(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, job := range s.jobs {
+		if job.next.IsZero() || job.next.After(now) {
+			continue
+		}
+
+		due := job.next
+		job.next = job.schedule.Next(now)
+
+		// the process was suspended or the clock jumped
+		if now.Sub(due) > missedRunGrace && job.config.Missed == MissedSkip {
+			log.Warnf("job %s skipped the run at %s", job.config.Name, due.Format("2006-01-02 15:04"))
+			continue
+		}
+
+		if job.running {
+			log.Warnf("job %s is still running, the run at %s is skipped", job.config.Name, due.Format("2006-01-02 15:04"))
+			continue
+		}
+
+		s.start(job, now)
+	}
+}
+
+// start must be called with the mutex held, the run keeps the config it was started with.
+func (s *Scheduler) start(job *scheduledJob, now time.Time) {
+	job.running = true
+	job.startedAt = now
+	s.inFlight.Add(1)
+
+	name, timeout, run := job.config.Name, job.timeout, job.run
+
+	go func() {
+		defer s.inFlight.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("job %s panic: %v", name, r)
+			}
+
+			s.mutex.Lock()
+			job.running = false
+			s.mutex.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(s.jobsContext, timeout)
+		defer cancel()
+
+		unlock, ok, err := lockJob(ctx, name)
+		if err != nil {
+			log.Warnf("can't lock job %s: %v", name, err)
+			return
+		}
+		if !ok {
+			log.Infof("job %s is running in another replica, the run at %s is skipped", name, now.Format("2006-01-02 15:04"))
+			return
+		}
+		defer unlock()
+
+		s.mutex.Lock()
+		job.lastRun = now
+		s.mutex.Unlock()
+
+		if err := s.saveRun(name, now); err != nil {
+			log.Warnf("can't save scheduler run: %v", err)
+		}
+
+		run(ctx)
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Warnf("job %s timed out after %s", name, timeout)
+		}
+	}()
+}
+
+// shutdown waits for the running jobs, shutdownQueueTimeout before the deadline they are cancelled
+// and stop at the next query or subscriber.
+func (s *Scheduler) shutdown(deadline time.Time) {
+	if waitUntil(&s.inFlight, deadline.Add(-shutdownQueueTimeout)) {
+		return
+	}
+
+	log.Warn("jobs are still running, cancelling them")
+	s.cancelJobs()
+
+	if !waitUntil(&s.inFlight, deadline) {
+		log.Warn("jobs did not stop in time")
+	}
+}
+
+func (s *Scheduler) String() string {
+	s.mutex.Lock()
+	var jobs []scheduledJob
+	var names []string
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+		names = append(names, job.config.Name)
+	}
+	s.mutex.Unlock()
+
+	locks, err := getJobLocks(names)
+	if err != nil {
+		log.Warnf("can't get job locks: %v", err)
+	}
+
+	sort.SliceStable(jobs, func(a, b int) bool {
+		return jobs[a].next.Before(jobs[b].next)
+	})
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Job", "Schedule", "Timeout", "Next run", "Last run", "Lock"})
+
+	now := time.Now()
+
+	for _, job := range jobs {
+		lastRun := "-"
+		if !job.lastRun.IsZero() {
+			lastRun = job.lastRun.Format("01-02 15:04")
+		}
+
+		lock := "-"
+		switch {
+		case job.running:
+			running := now.Sub(job.startedAt).Round(time.Second)
+			lock = "running " + running.String()
+			if running > job.timeout {
+				lock += ", timed out"
+			}
+		case locks[job.config.Name]:
+			lock = "other replica"
+		}
+
+		table.Append([]string{job.config.Name, job.schedule.String(), job.config.Timeout, job.next.Format("01-02 15:04"), lastRun, lock})
+	}
+
+	table.Render()
+
+	return tableString.String()
+}
+
+func getSchedulerRuns() (map[string]time.Time, error) {
+	var runs []SchedulerRun
+	if err := dbConnect.Model(&runs).Select(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]time.Time, len(runs))
+	for _, run := range runs {
+		result[run.Job] = run.LastRunAt
+	}
+
+	return result, nil
+}
+
+func saveSchedulerRun(job string, at time.Time) error {
+	_, err := dbConnect.Model(&SchedulerRun{Job: job, LastRunAt: at}).
+		OnConflict("(job) DO UPDATE").
+		Set("last_run_at = EXCLUDED.last_run_at").
+		Insert()
+
+	return err
+}
+
+func isAdmin(subscriber *Subscriber) bool {
+	for _, id := range getConfig().Admins {
+		if id == subscriber.TelegramId {
+			return true
+		}
+	}
+	return false
+}
+
+func handleJobsCommand(subscriber *Subscriber) string {
+	if !isAdmin(subscriber) {
+		return "The command is for admins only"
+	}
+
+	if scheduler == nil {
+		return "Scheduler is not running"
+	}
+
+	return fmt.Sprintf("Server time %s\n%s", time.Now().Format("01-02 15:04 MST"), scheduler.String())
+}
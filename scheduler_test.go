@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testScheduler keeps the runs in memory, the advisory lock is off in the zero config.
+func testScheduler(t *testing.T, runners map[string]func(ctx context.Context)) (*Scheduler, *sync.Map) {
+	setConfig(Config{})
+
+	runs := &sync.Map{}
+	s := newScheduler(runners)
+	s.loadRuns = func() (map[string]time.Time, error) {
+		lastRuns := make(map[string]time.Time)
+		runs.Range(func(job, at interface{}) bool {
+			lastRuns[job.(string)] = at.(time.Time)
+			return true
+		})
+		return lastRuns, nil
+	}
+	s.saveRun = func(job string, at time.Time) error {
+		runs.Store(job, at)
+		return nil
+	}
+	t.Cleanup(func() {
+		s.cancelJobs()
+		waitUntil(&s.inFlight, time.Now().Add(time.Second))
+	})
+
+	return s, runs
+}
+
+// job copies the state of a job under the mutex.
+func (s *Scheduler) job(name string) scheduledJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, job := range s.jobs {
+		if job.config.Name == name {
+			return *job
+		}
+	}
+	return scheduledJob{}
+}
+
+func TestSchedulerReloadWhileRunning(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	s, _ := testScheduler(t, map[string]func(ctx context.Context){
+		JobMovers: func(ctx context.Context) {
+			started <- struct{}{}
+			<-release
+		},
+	})
+
+	configs := []JobConfig{{Name: JobMovers, Schedule: "* * * * *", Missed: MissedSkip, Timeout: "1m"}}
+	s.reload(configs)
+
+	now := s.job(JobMovers).next
+	s.runDue(now)
+	<-started
+
+	configs[0].Timeout = "2m"
+	s.reload(configs)
+	if job := s.job(JobMovers); !job.running || job.timeout != 2*time.Minute {
+		t.Fatalf("got running %v, timeout %s after the reload", job.running, job.timeout)
+	}
+
+	close(release)
+	if !waitUntil(&s.inFlight, time.Now().Add(time.Second)) {
+		t.Fatal("the job didn't finish")
+	}
+	if s.job(JobMovers).running {
+		t.Fatal("the job stayed running after the reload")
+	}
+
+	// the next run starts again
+	s.runDue(s.job(JobMovers).next)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("the job didn't start after the reload")
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+
+	runner := func(name string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			started <- name
+			<-release
+		}
+	}
+	s, runs := testScheduler(t, map[string]func(ctx context.Context){
+		JobMovers:        runner(JobMovers),
+		JobConsolidation: runner(JobConsolidation),
+	})
+	s.reload([]JobConfig{
+		{Name: JobMovers, Schedule: "* * * * *", Missed: MissedSkip, Timeout: "1m"},
+		{Name: JobConsolidation, Schedule: "* * * * *", Missed: MissedRunOnce, Timeout: "1m"},
+	})
+
+	// late by more than missedRunGrace, the skip job drops the run and the run-once job makes it up
+	due := s.job(JobMovers).next
+	late := due.Add(2 * missedRunGrace)
+	s.runDue(late)
+	if name := <-started; name != JobConsolidation {
+		t.Fatalf("got %s started, want %s", name, JobConsolidation)
+	}
+	if next := s.job(JobMovers).next; !next.After(late) {
+		t.Errorf("got next run %s, want after %s", next, late)
+	}
+
+	// the next run comes while the run-once job is still running
+	s.runDue(s.job(JobMovers).next)
+	if name := <-started; name != JobMovers {
+		t.Fatalf("got %s started, want %s", name, JobMovers)
+	}
+	select {
+	case name := <-started:
+		t.Fatalf("got %s started again while running", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if !waitUntil(&s.inFlight, time.Now().Add(time.Second)) {
+		t.Fatal("the jobs didn't finish")
+	}
+	if at, ok := runs.Load(JobConsolidation); !ok || !at.(time.Time).Equal(late) {
+		t.Errorf("got last run %v, want %s", at, late)
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	started := make(chan string, 10)
+	runner := func(name string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			started <- name
+		}
+	}
+
+	s, runs := testScheduler(t, map[string]func(ctx context.Context){
+		JobMovers:        runner(JobMovers),
+		JobVolume:        runner(JobVolume),
+		JobConsolidation: runner(JobConsolidation),
+		JobQuietSummary:  runner(JobQuietSummary),
+	})
+	s.reload([]JobConfig{
+		{Name: JobMovers, Schedule: "0 10 * * *", Missed: MissedSkip, Timeout: "1m"},
+		{Name: JobVolume, Schedule: "0 10 * * *", Missed: MissedRunOnce, Timeout: "1m"},
+		{Name: JobConsolidation, Schedule: "0 10 * * *", Missed: MissedRunOnce, Timeout: "1m"},
+		{Name: JobQuietSummary, Schedule: "0 10 * * *", Missed: MissedRunOnce, Timeout: "1m"},
+	})
+
+	// the consolidation missed the runs of two days, the volume ran after the last due run,
+	// the quiet summary never ran
+	lastDue := s.job(JobConsolidation).next.AddDate(0, 0, -1)
+	runs.Store(JobMovers, lastDue.AddDate(0, 0, -2))
+	runs.Store(JobVolume, lastDue.Add(time.Minute))
+	runs.Store(JobConsolidation, lastDue.AddDate(0, 0, -2))
+
+	s.catchUp()
+	if !waitUntil(&s.inFlight, time.Now().Add(time.Second)) {
+		t.Fatal("the jobs didn't finish")
+	}
+
+	close(started)
+	var names []string
+	for name := range started {
+		names = append(names, name)
+	}
+	if len(names) != 1 || names[0] != JobConsolidation {
+		t.Errorf("got %v started, want a single %s", names, JobConsolidation)
+	}
+	if job := s.job(JobVolume); !job.lastRun.Equal(lastDue.Add(time.Minute)) {
+		t.Errorf("got volume last run %s, want the recorded one", job.lastRun)
+	}
+}
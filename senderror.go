@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/olekukonko/tablewriter"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	// SendErrorTransient may pass on retry: network, 429, Telegram or smtp server errors
+	SendErrorTransient = "transient"
+	// SendErrorPermanent means the subscriber can't be reached over Telegram anymore, the subscriber is disabled
+	SendErrorPermanent = "permanent"
+	// SendErrorRejected means the message or the address is refused, retrying the same one won't help
+	SendErrorRejected = "rejected"
+)
+
+const (
+	DisabledReasonBlocked      = "blocked"
+	DisabledReasonDeactivated  = "deactivated"
+	DisabledReasonKicked       = "kicked"
+	DisabledReasonNotStarted   = "not_started"
+	DisabledReasonChatNotFound = "chat_not_found"
+	DisabledReasonForbidden    = "forbidden"
+)
+
+// SendError is a delivery error classified by the notifier.
+type SendError struct {
+	Kind string
+	// Reason is set for permanent errors and stored on the disabled subscriber
+	Reason string
+	Code   int
+	Err    error
+}
+
+func (e *SendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// isFinalSendError reports whether retrying err is useless, unclassified errors are retried.
+func isFinalSendError(err error) bool {
+	var sendErr *SendError
+	return errors.As(err, &sendErr) && sendErr.Kind != SendErrorTransient
+}
+
+// telegramForbiddenReasons match the descriptions of 403 responses, Telegram has no finer codes.
+var telegramForbiddenReasons = []struct {
+	description string
+	reason      string
+}{
+	{"bot was blocked by the user", DisabledReasonBlocked},
+	{"user is deactivated", DisabledReasonDeactivated},
+	{"bot was kicked", DisabledReasonKicked},
+	{"bot is not a member", DisabledReasonKicked},
+	{"bot can't initiate conversation", DisabledReasonNotStarted},
+}
+
+func classifyTelegramError(err error) *SendError {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr
+	}
+
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return &SendError{Kind: SendErrorTransient, Err: err}
+	}
+
+	result := &SendError{Kind: SendErrorTransient, Code: apiErr.Code, Err: err}
+	description := strings.ToLower(apiErr.Message)
+
+	switch {
+	case apiErr.Code == http.StatusForbidden:
+		result.Kind = SendErrorPermanent
+		result.Reason = DisabledReasonForbidden
+		for _, forbidden := range telegramForbiddenReasons {
+			if strings.Contains(description, forbidden.description) {
+				result.Reason = forbidden.reason
+				break
+			}
+		}
+	case apiErr.Code == http.StatusBadRequest && apiErr.MigrateToChatID != 0:
+		// the notifier follows the migrated chat, this is left when moving the subscriber failed
+		result.Kind = SendErrorTransient
+	case apiErr.Code == http.StatusBadRequest && strings.Contains(description, "chat not found"):
+		result.Kind = SendErrorPermanent
+		result.Reason = DisabledReasonChatNotFound
+	case apiErr.Code == http.StatusBadRequest:
+		result.Kind = SendErrorRejected
+	}
+
+	// 401 and 404 are a wrong token or endpoint, they must not disable anybody
+	return result
+}
+
+// classifySmtpError never returns SendErrorPermanent: a rejected mailbox must not unsubscribe the Telegram chat.
+func classifySmtpError(err error) *SendError {
+	var sendErr *SendError
+	if errors.As(err, &sendErr) {
+		return sendErr
+	}
+
+	result := &SendError{Kind: SendErrorTransient, Err: err}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		result.Code = smtpErr.Code
+		if smtpErr.Code >= 500 {
+			result.Kind = SendErrorRejected
+		}
+	}
+
+	return result
+}
+
+type subscribersStatusCount struct {
+	IsEnabled      int8
+	DisabledReason string
+	Count          int
+}
+
+func handleSubscribersCommand(subscriber *Subscriber) string {
+	if !isAdmin(subscriber) {
+		return "The command is for admins only"
+	}
+
+	var counts []subscribersStatusCount
+	_, err := dbConnect.Query(&counts, `
+		SELECT is_enabled, coalesce(disabled_reason, '') AS disabled_reason, count(*) AS count
+		FROM notifications_subscribers
+		GROUP BY 1, 2
+		ORDER BY 1 DESC, 3 DESC`)
+
+	if err != nil {
+		log.Warnf("can't get subscribers status: %v", err)
+		return "Возникла ошибка №435/11"
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Status", "Count"})
+
+	for _, count := range counts {
+		status := "enabled"
+		if count.IsEnabled == Subscriber_IS_ENABLED_FALSE {
+			status = "disabled"
+			if count.DisabledReason != "" {
+				status += ", " + count.DisabledReason
+			}
+		}
+
+		table.Append([]string{status, IntToStr(count.Count)})
+	}
+
+	table.Render()
+
+	return tableString.String()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// shutdownTimeout is the whole shutdown, docker kills the container 10 seconds after SIGTERM
+	shutdownTimeout = 9 * time.Second
+	// shutdownQueueTimeout is the end of the shutdown left to the cancelled jobs to stop
+	shutdownQueueTimeout = 3 * time.Second
+)
+
+// waitUntil reports whether the wait group is done before the deadline.
+func waitUntil(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
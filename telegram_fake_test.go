@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const fakeBotToken = "123:fake-token"
+
+// FakeRequest is a Bot API call received by FakeBotAPI, getUpdates calls are not recorded.
+type FakeRequest struct {
+	Method string
+	Params url.Values
+	Files  map[string][]byte
+}
+
+func (r FakeRequest) chatId() int64 {
+	id, _ := strconv.ParseInt(r.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+// FakeError is the Bot API error returned to the next matching call.
+type FakeError struct {
+	Code            int
+	Description     string
+	RetryAfter      int
+	MigrateToChatId int64
+
+	method string
+	chatId int64
+}
+
+// FakeBotAPI is an httptest Bot API server, it records the calls, serves the pushed updates to getUpdates
+// and answers with the injected errors.
+type FakeBotAPI struct {
+	server *httptest.Server
+
+	mutex     sync.Mutex
+	requests  []FakeRequest
+	updates   []tgbotapi.Update
+	errors    []FakeError
+	updateId  int
+	messageId int
+	// changed is closed and replaced when a request or an update arrives
+	changed chan struct{}
+	closed  chan struct{}
+	close   sync.Once
+}
+
+func newFakeBotAPI(t *testing.T) *FakeBotAPI {
+	fake := &FakeBotAPI{
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+func (f *FakeBotAPI) Close() {
+	f.close.Do(func() {
+		close(f.closed)
+		f.server.Close()
+	})
+}
+
+// bot creates the bot client the way main does, with the fake server in the config.
+func (f *FakeBotAPI) bot(t *testing.T) *tgbotapi.BotAPI {
+	bot, err := newTelegramBot(Config{TelegramBot: fakeBotToken, TelegramApi: f.server.URL})
+	if err != nil {
+		t.Fatalf("can't create bot: %v", err)
+	}
+
+	return bot
+}
+
+// notifyLocked wakes the waiters, the mutex must be held.
+func (f *FakeBotAPI) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *FakeBotAPI) pushUpdate(update tgbotapi.Update) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.updateId++
+	update.UpdateID = f.updateId
+	f.updates = append(f.updates, update)
+	f.notifyLocked()
+}
+
+// pushMessage makes a private chat message, a text starting with / is a command.
+func (f *FakeBotAPI) pushMessage(chatId int64, text string) {
+	message := &tgbotapi.Message{
+		Date: int(time.Now().Unix()),
+		From: &tgbotapi.User{ID: chatId, FirstName: "Test", UserName: "test" + strconv.FormatInt(chatId, 10)},
+		Chat: &tgbotapi.Chat{ID: chatId, Type: "private", FirstName: "Test", UserName: "test" + strconv.FormatInt(chatId, 10)},
+		Text: text,
+	}
+
+	if strings.HasPrefix(text, "/") {
+		length := len(text)
+		if i := strings.Index(text, " "); i != -1 {
+			length = i
+		}
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}
+	}
+
+	f.pushUpdate(tgbotapi.Update{Message: message})
+}
+
+func (f *FakeBotAPI) pushCallbackQuery(chatId int64, data string) {
+	f.pushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   "callback" + strconv.FormatInt(chatId, 10),
+		From: &tgbotapi.User{ID: chatId, FirstName: "Test"},
+		Data: data,
+	}})
+}
+
+// fail makes the next call of the method to the chat return err, chatId 0 matches any chat.
+func (f *FakeBotAPI) fail(method string, chatId int64, err FakeError) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	err.method = method
+	err.chatId = chatId
+	f.errors = append(f.errors, err)
+}
+
+func (f *FakeBotAPI) requestsFor(method string) []FakeRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var result []FakeRequest
+	for _, request := range f.requests {
+		if request.Method == method {
+			result = append(result, request)
+		}
+	}
+
+	return result
+}
+
+// waitRequests waits for count calls of the method and fails the test after the timeout.
+func (f *FakeBotAPI) waitRequests(t *testing.T, method string, count int, timeout time.Duration) []FakeRequest {
+	t.Helper()
+
+	deadline := time.After(timeout)
+
+	for {
+		f.mutex.Lock()
+		changed := f.changed
+		f.mutex.Unlock()
+
+		if requests := f.requestsFor(method); len(requests) >= count {
+			return requests
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("got %d %s requests, want %d", len(f.requestsFor(method)), method, count)
+		}
+	}
+}
+
+func (f *FakeBotAPI) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/bot")
+	slash := strings.LastIndex(path, "/")
+	if slash == -1 || path[:slash] != fakeBotToken {
+		writeFakeError(w, FakeError{Code: http.StatusUnauthorized, Description: "Unauthorized"})
+		return
+	}
+	method := path[slash+1:]
+
+	request, err := parseFakeRequest(method, r)
+	if err != nil {
+		writeFakeError(w, FakeError{Code: http.StatusBadRequest, Description: "Bad Request: " + err.Error()})
+		return
+	}
+
+	if method == "getUpdates" {
+		f.getUpdates(w, r, request)
+		return
+	}
+
+	f.mutex.Lock()
+	f.requests = append(f.requests, request)
+	f.notifyLocked()
+	fakeErr, failed := f.takeErrorLocked(request)
+	f.mutex.Unlock()
+
+	if failed {
+		writeFakeError(w, fakeErr)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeFakeResult(w, tgbotapi.User{ID: 1, IsBot: true, FirstName: "Fake", UserName: "fake_bot"})
+	case "sendMessage":
+		message := f.newMessage(request)
+		message.Text = request.Params.Get("text")
+		writeFakeResult(w, message)
+	case "sendPhoto":
+		message := f.newMessage(request)
+		message.Photo = []tgbotapi.PhotoSize{{FileID: "photo" + strconv.Itoa(message.MessageID), Width: 800, Height: 600}}
+		writeFakeResult(w, message)
+	case "answerCallbackQuery":
+		writeFakeResult(w, true)
+	default:
+		writeFakeError(w, FakeError{Code: http.StatusNotFound, Description: "Not Found: method not found"})
+	}
+}
+
+func (f *FakeBotAPI) takeErrorLocked(request FakeRequest) (FakeError, bool) {
+	for i, fakeErr := range f.errors {
+		if fakeErr.method == request.Method && (fakeErr.chatId == 0 || fakeErr.chatId == request.chatId()) {
+			f.errors = append(f.errors[:i], f.errors[i+1:]...)
+			return fakeErr, true
+		}
+	}
+
+	return FakeError{}, false
+}
+
+func (f *FakeBotAPI) newMessage(request FakeRequest) tgbotapi.Message {
+	f.mutex.Lock()
+	f.messageId++
+	id := f.messageId
+	f.mutex.Unlock()
+
+	return tgbotapi.Message{
+		MessageID: id,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: request.chatId(), Type: "private"},
+	}
+}
+
+// getUpdates long polls like the Bot API, it returns the updates from offset once there are any.
+func (f *FakeBotAPI) getUpdates(w http.ResponseWriter, r *http.Request, request FakeRequest) {
+	offset, _ := strconv.Atoi(request.Params.Get("offset"))
+	timeout, _ := strconv.Atoi(request.Params.Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		f.mutex.Lock()
+		var updates []tgbotapi.Update
+		for _, update := range f.updates {
+			if update.UpdateID >= offset {
+				updates = append(updates, update)
+			}
+		}
+		changed := f.changed
+		f.mutex.Unlock()
+
+		if len(updates) > 0 {
+			writeFakeResult(w, updates)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			writeFakeResult(w, []tgbotapi.Update{})
+			return
+		case <-r.Context().Done():
+			return
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+func parseFakeRequest(method string, r *http.Request) (FakeRequest, error) {
+	request := FakeRequest{Method: method, Params: url.Values{}, Files: make(map[string][]byte)}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseForm(); err != nil {
+			return request, err
+		}
+		request.Params = r.PostForm
+		return request, nil
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return request, err
+	}
+	request.Params = url.Values(r.MultipartForm.Value)
+
+	for field, headers := range r.MultipartForm.File {
+		file, err := headers[0].Open()
+		if err != nil {
+			return request, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return request, err
+		}
+		request.Files[field] = data
+	}
+
+	return request, nil
+}
+
+func writeFakeResult(w http.ResponseWriter, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeFakeError(w, FakeError{Code: http.StatusInternalServerError, Description: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func writeFakeError(w http.ResponseWriter, fakeErr FakeError) {
+	response := tgbotapi.APIResponse{ErrorCode: fakeErr.Code, Description: fakeErr.Description}
+	if fakeErr.RetryAfter > 0 || fakeErr.MigrateToChatId != 0 {
+		response.Parameters = &tgbotapi.ResponseParameters{RetryAfter: fakeErr.RetryAfter, MigrateToChatID: fakeErr.MigrateToChatId}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(fakeErr.Code)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,82 @@
+-- The schema of a database from before the migrations, the loader tables and the notifications tables
+-- the bot used then, with a subscriber and a sent notification.
+
+CREATE TABLE coins
+(
+    id         BIGSERIAL PRIMARY KEY,
+    code       VARCHAR(32) NOT NULL UNIQUE,
+    rank       INTEGER     NOT NULL DEFAULT 0,
+    is_enabled SMALLINT    NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE coins_pairs
+(
+    id         BIGSERIAL PRIMARY KEY,
+    coin_id    BIGINT      NOT NULL REFERENCES coins (id) ON DELETE CASCADE,
+    couple     VARCHAR(32) NOT NULL,
+    is_enabled SMALLINT    NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE klines
+(
+    id                           BIGSERIAL PRIMARY KEY,
+    coin_pair_id                 BIGINT           NOT NULL REFERENCES coins_pairs (id) ON DELETE CASCADE,
+    open_time                    TIMESTAMPTZ      NOT NULL,
+    close_time                   TIMESTAMPTZ      NOT NULL,
+    open                         DOUBLE PRECISION NOT NULL,
+    high                         DOUBLE PRECISION NOT NULL,
+    low                          DOUBLE PRECISION NOT NULL,
+    close                        DOUBLE PRECISION NOT NULL,
+    volume                       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    quote_asset_volume           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trade_num                    BIGINT           NOT NULL DEFAULT 0,
+    taker_buy_base_asset_volume  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    taker_buy_quote_asset_volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ratio_open_close             DOUBLE PRECISION,
+    ratio_high_low               DOUBLE PRECISION
+);
+
+CREATE FUNCTION CAlC_PERCENT(open_price DOUBLE PRECISION, close_price DOUBLE PRECISION)
+    RETURNS DOUBLE PRECISION AS
+$$
+SELECT CASE WHEN open_price = 0 THEN 0 ELSE (close_price - open_price) / open_price * 100 END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE FUNCTION date_round_down(base_date TIMESTAMPTZ, round_interval INTERVAL)
+    RETURNS TIMESTAMPTZ AS
+$$
+SELECT to_timestamp(floor(extract(EPOCH FROM base_date) / extract(EPOCH FROM round_interval)) *
+                    extract(EPOCH FROM round_interval))
+$$ LANGUAGE SQL STABLE;
+
+CREATE TABLE notifications_subscribers
+(
+    id                  BIGSERIAL PRIMARY KEY,
+    is_enabled          SMALLINT    NOT NULL DEFAULT 1,
+    telegram_id         BIGINT      NOT NULL,
+    telegram_first_name VARCHAR(255),
+    telegram_last_name  VARCHAR(255),
+    telegram_username   VARCHAR(255),
+    email               VARCHAR(255),
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMPTZ
+);
+
+CREATE TABLE notifications_logs
+(
+    id            BIGSERIAL PRIMARY KEY,
+    subscriber_id BIGINT      NOT NULL
+        CONSTRAINT notifications_logs_subscriber_id_foreign REFERENCES notifications_subscribers (id) ON DELETE CASCADE,
+    notification  TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ
+);
+
+INSERT INTO coins (id, code, rank) VALUES (1, 'BTC', 1);
+INSERT INTO coins_pairs (id, coin_id, couple) VALUES (1, 1, 'BUSD');
+INSERT INTO notifications_subscribers (id, telegram_id, telegram_first_name) VALUES (1, 300, 'Old');
+INSERT INTO notifications_logs (subscriber_id, notification) VALUES (1, 'BTC 5%');
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/olekukonko/tablewriter"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultThresholds = Thresholds{
+	Minute10:    2,
+	Hour:        3,
+	Hour4:       4,
+	Hour12:      8,
+	Hour24:      10,
+	PercentSum:  2,
+	VolumeSpike: 3,
+	TradeSpike:  2,
+}
+
+// matches keeps the signed percent_sum rule, so a drop passes only a threshold below its sum.
+func (t Thresholds) matches(coin PercentCoinShort) bool {
+	if coin.PercentSum < t.PercentSum {
+		return false
+	}
+
+	return math.Abs(coin.Minute10) >= t.Minute10 ||
+		math.Abs(coin.Hour) >= t.Hour ||
+		math.Abs(coin.Hour4) >= t.Hour4 ||
+		math.Abs(coin.Hour12) >= t.Hour12 ||
+		math.Abs(coin.Hour24) >= t.Hour24
+}
+
+func (t *Thresholds) set(window string, value float64) error {
+	if value < 0 {
+		return errors.New("threshold can't be negative")
+	}
+
+	switch strings.ToLower(window) {
+	case "10m":
+		t.Minute10 = value
+	case "1h":
+		t.Hour = value
+	case "4h":
+		t.Hour4 = value
+	case "12h":
+		t.Hour12 = value
+	case "24h":
+		t.Hour24 = value
+	case "sum":
+		t.PercentSum = value
+	case "volume":
+		t.VolumeSpike = value
+	case "trades":
+		t.TradeSpike = value
+	default:
+		return errors.New("unknown window " + window + ", use 10m, 1h, 4h, 12h, 24h, sum, volume or trades")
+	}
+
+	return nil
+}
+
+func (t Thresholds) String() string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Window", "Value"})
+
+	table.Append([]string{"10m", FloatToStr(t.Minute10)})
+	table.Append([]string{"1h", FloatToStr(t.Hour)})
+	table.Append([]string{"4h", FloatToStr(t.Hour4)})
+	table.Append([]string{"12h", FloatToStr(t.Hour12)})
+	table.Append([]string{"24h", FloatToStr(t.Hour24)})
+	table.Append([]string{"sum", FloatToStr(t.PercentSum)})
+	table.Append([]string{"volume", FloatToStr(t.VolumeSpike) + "x"})
+	table.Append([]string{"trades", FloatToStr(t.TradeSpike) + "x"})
+
+	table.Render()
+
+	return tableString.String()
+}
+
+func filterPercentCoins(coins []PercentCoinShort, thresholds Thresholds) []PercentCoinShort {
+	var result []PercentCoinShort
+
+	for _, coin := range coins {
+		if thresholds.matches(coin) {
+			result = append(result, coin)
+		}
+	}
+
+	return result
+}
+
+func (s *Subscriber) getThresholds() (Thresholds, error) {
+	settings := SubscriberSettings{}
+	err := dbConnect.Model(&settings).
+		Where("subscriber_id = ?", s.Id).
+		Select()
+
+	if errors.Is(err, pg.ErrNoRows) {
+		return getConfig().Thresholds, nil
+	}
+
+	if err != nil {
+		return getConfig().Thresholds, err
+	}
+
+	return settings.Thresholds, nil
+}
+
+func (s *Subscriber) saveThresholds(thresholds Thresholds) (err error) {
+	settings := &SubscriberSettings{
+		SubscriberId: s.Id,
+		Thresholds:   thresholds,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	_, err = dbConnect.Model(settings).
+		OnConflict("(subscriber_id) DO UPDATE").
+		Set("minute10 = EXCLUDED.minute10").
+		Set("hour = EXCLUDED.hour").
+		Set("hour4 = EXCLUDED.hour4").
+		Set("hour12 = EXCLUDED.hour12").
+		Set("hour24 = EXCLUDED.hour24").
+		Set("percent_sum = EXCLUDED.percent_sum").
+		Set("volume_spike = EXCLUDED.volume_spike").
+		Set("trade_spike = EXCLUDED.trade_spike").
+		Set("updated_at = EXCLUDED.updated_at").
+		Insert()
+
+	return err
+}
+
+func getSubscribersThresholds(subscribers []Subscriber) (map[int64]Thresholds, error) {
+	result := make(map[int64]Thresholds, len(subscribers))
+
+	if len(subscribers) == 0 {
+		return result, nil
+	}
+
+	ids := make([]int64, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		ids = append(ids, subscriber.Id)
+		result[subscriber.Id] = getConfig().Thresholds
+	}
+
+	var settings []SubscriberSettings
+	err := dbConnect.Model(&settings).
+		Where("subscriber_id IN (?)", pg.In(ids)).
+		Select()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, setting := range settings {
+		result[setting.SubscriberId] = setting.Thresholds
+	}
+
+	return result, nil
+}
+
+func handleThresholdCommand(subscriber *Subscriber, arguments string) string {
+	thresholds, err := subscriber.getThresholds()
+	if err != nil {
+		log.Warnf("can't get subscriber thresholds: %v", err)
+		return "Возникла ошибка №435/4"
+	}
+
+	args := strings.Fields(arguments)
+
+	switch {
+	case len(args) == 0:
+		return thresholds.String() + "\nChange: /threshold 1h 2.5, reset: /threshold reset"
+	case len(args) == 1 && args[0] == "reset":
+		thresholds = getConfig().Thresholds
+	case len(args) == 2:
+		value, err := strconv.ParseFloat(strings.Replace(args[1], ",", ".", 1), 64)
+		if err != nil {
+			return "Invalid value " + args[1]
+		}
+
+		if err := thresholds.set(args[0], value); err != nil {
+			return err.Error()
+		}
+	default:
+		return "Usage: /threshold <10m|1h|4h|12h|24h|sum|volume|trades> <value>"
+	}
+
+	if err := subscriber.saveThresholds(thresholds); err != nil {
+		log.Warnf("can't save subscriber thresholds: %v", err)
+		return "Возникла ошибка №435/4"
+	}
+
+	return thresholds.String()
+}
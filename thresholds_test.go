@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestThresholdsMatchPercentSum(t *testing.T) {
+	thresholds := Thresholds{Minute10: 2, Hour: 3, Hour4: 4, Hour12: 8, Hour24: 10, PercentSum: 2}
+
+	tests := []struct {
+		coin      PercentCoinShort
+		matches   bool
+		direction string
+	}{
+		{PercentCoinShort{Code: "UP", Hour: 3.5, PercentSum: 4}, true, "up"},
+		// the percent sum is signed, a drop doesn't reach a positive threshold
+		{PercentCoinShort{Code: "DOWN", Hour: -3.5, PercentSum: -4}, false, "down"},
+		{PercentCoinShort{Code: "FLAT", Hour: 3.5, Hour4: -3, PercentSum: 0.5}, false, "up"},
+		{PercentCoinShort{Code: "SLOW", Hour: -1, PercentSum: -2.5}, false, "down"},
+	}
+
+	for _, test := range tests {
+		if got := thresholds.matches(test.coin); got != test.matches {
+			t.Errorf("%s: got matches %v, want %v", test.coin.Code, got, test.matches)
+		}
+
+		logged := newMoverLoggedCoin(test.coin)
+		if logged.Direction != test.direction || logged.Value < 0 {
+			t.Errorf("%s: got %s %v, want %s", test.coin.Code, logged.Direction, logged.Value, test.direction)
+		}
+	}
+}
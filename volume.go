@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/olekukonko/tablewriter"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+	"strings"
+)
+
+func filterVolumeSpikes(spikes []VolumeSpike, thresholds Thresholds) []VolumeSpike {
+	var result []VolumeSpike
+
+	if thresholds.VolumeSpike <= 0 {
+		return result
+	}
+
+	for _, spike := range spikes {
+		// the trades must grow too, a single large trade raises the volume alone
+		if spike.VolumeRatio >= thresholds.VolumeSpike && spike.TradeRatio >= thresholds.TradeSpike {
+			result = append(result, spike)
+		}
+	}
+
+	return result
+}
+
+func formatVolumeSpikes(spikes []VolumeSpike, quote string) string {
+	if len(spikes) == 0 {
+		return ""
+	}
+
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	table.SetHeader([]string{"Name", "Volume 1h", "Ratio", "Trades ratio"})
+	table.SetCaption(true, "Volume spike, "+quote+".")
+
+	for _, spike := range spikes {
+		table.Append([]string{
+			spike.Code + " [" + IntToStr(spike.Rank) + "]",
+			FloatToStr(spike.QuoteVolume),
+			FloatToStr(spike.VolumeRatio) + "x",
+			FloatToStr(spike.TradeRatio) + "x",
+		})
+	}
+
+	table.Render()
+
+	return tableString.String()
+}
+
+func sendVolumeSpikes(ctx context.Context) {
+	log.Info("send volume spikes")
+
+	var subscribers []Subscriber
+	err := dbConnect.ModelContext(ctx, &subscribers).
+		Where("is_enabled = ?", 1).
+		Select()
+
+	if err != nil {
+		log.Warnf("can't get subscribers: %v", err)
+		return
+	}
+
+	thresholds, err := getSubscribersThresholds(subscribers)
+	if err != nil {
+		log.Warnf("can't get subscribers thresholds: %v", err)
+		return
+	}
+
+	history, err := loadNotificationHistory(NotificationKindVolume, subscribers)
+	if err != nil {
+		log.Warnf("can't get notifications history: %v", err)
+	}
+
+	for quote, quoteSubscribers := range groupSubscribersByQuote(subscribers) {
+		if ctx.Err() != nil {
+			return
+		}
+		sendQuoteVolumeSpikes(ctx, quote, quoteSubscribers, thresholds, history)
+	}
+}
+
+func sendQuoteVolumeSpikes(ctx context.Context, quote string, subscribers []*Subscriber, thresholds map[int64]Thresholds, history notificationHistory) {
+	spikes, err := marketData.WithContext(ctx).GetVolumeSpikes(quote)
+	if err != nil {
+		log.Errorf("can't get volume spikes: %v", err)
+		return
+	}
+
+	if len(spikes) == 0 {
+		log.Debugf("no volume spikes for %s", quote)
+		return
+	}
+
+	graphs := make(map[string][]byte)
+
+	// the cancellation stops the queries only, the computed spikes are queued for every subscriber
+	for _, subscriber := range subscribers {
+		var subscriberSpikes []VolumeSpike
+		var loggedCoins []LoggedCoin
+
+		for _, spike := range filterVolumeSpikes(spikes, thresholds[subscriber.Id]) {
+			loggedCoin := LoggedCoin{Code: spike.Code, Direction: "spike", Value: spike.VolumeRatio}
+			if history.isRepeated(subscriber.Id, loggedCoin) {
+				continue
+			}
+			subscriberSpikes = append(subscriberSpikes, spike)
+			loggedCoins = append(loggedCoins, loggedCoin)
+		}
+
+		if len(subscriberSpikes) == 0 {
+			continue
+		}
+
+		code := subscriberSpikes[0].Code
+		graph, ok := graphs[code]
+		if !ok {
+			graph, err = renderVolumeGraph(code, quote)
+			if err != nil {
+				log.Warnf("can't render volume graph: %v", err)
+			}
+			graphs[code] = graph
+		}
+
+		notificationText := formatVolumeSpikes(subscriberSpikes, quote)
+
+		notify(subscriber, NotificationKindVolume, notificationText, graph, loggedCoins)
+	}
+}
+
+func renderVolumeGraph(coin string, quote string) ([]byte, error) {
+	xv, yv, volumes := getDataForCoinGraph(coin, quote, "")
+
+	if len(xv) == 0 {
+		return nil, nil
+	}
+
+	priceSeries := chart.TimeSeries{
+		Name: pairName(coin, quote) + " 4H",
+		Style: chart.Style{
+			Show:        true,
+			StrokeColor: chart.GetDefaultColor(0),
+		},
+		XValues: xv,
+		YValues: yv,
+	}
+
+	volumeSeries := chart.TimeSeries{
+		Name:  coin + " - Volume",
+		YAxis: chart.YAxisSecondary,
+		Style: chart.Style{
+			Show:        true,
+			StrokeColor: drawing.ColorFromHex("b0b0b0"),
+			FillColor:   drawing.ColorFromHex("b0b0b0").WithAlpha(80),
+		},
+		XValues: xv,
+		YValues: volumes,
+	}
+
+	min, max := padRange(findMinAndMax(yv))
+	_, maxVolume := findMinAndMax(volumes)
+	_, maxVolume = padRange(0, maxVolume)
+
+	graph := chart.Chart{
+		XAxis: chart.XAxis{
+			Style:        chart.Style{Show: true},
+			TickPosition: chart.TickPositionBetweenTicks,
+		},
+		YAxis: chart.YAxis{
+			Style: chart.Style{Show: true},
+			Range: &chart.ContinuousRange{
+				Max: max,
+				Min: min,
+			},
+		},
+		YAxisSecondary: chart.YAxis{
+			Style: chart.Style{Show: true},
+			Range: &chart.ContinuousRange{
+				Max: maxVolume * 3, // volume occupies the lower third
+				Min: 0,
+			},
+		},
+		Series: []chart.Series{
+			volumeSeries,
+			priceSeries,
+		},
+	}
+
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph),
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
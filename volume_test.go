@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestFilterVolumeSpikes(t *testing.T) {
+	spikes := []VolumeSpike{
+		{Code: "BTC", VolumeRatio: 5, TradeRatio: 4},
+		{Code: "WHALE", VolumeRatio: 8, TradeRatio: 1.1},
+		{Code: "ETH", VolumeRatio: 2, TradeRatio: 3},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds Thresholds
+		want       []string
+	}{
+		{"volume and trades", Thresholds{VolumeSpike: 3, TradeSpike: 2}, []string{"BTC"}},
+		{"volume only", Thresholds{VolumeSpike: 3}, []string{"BTC", "WHALE"}},
+		{"low volume", Thresholds{VolumeSpike: 1, TradeSpike: 2}, []string{"BTC", "ETH"}},
+		{"disabled", Thresholds{TradeSpike: 2}, nil},
+	}
+
+	for _, test := range tests {
+		got := filterVolumeSpikes(spikes, test.thresholds)
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i, spike := range got {
+			if spike.Code != test.want[i] {
+				t.Errorf("%s: got %s at %d, want %s", test.name, spike.Code, i, test.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"github.com/go-pg/pg/v10"
+	"strings"
+	"time"
+)
+
+const watchlistLimit = 20
+
+func (s *Subscriber) getWatchlist() ([]string, error) {
+	var watchlist []WatchlistCoin
+	err := dbConnect.Model(&watchlist).
+		Where("subscriber_id = ?", s.Id).
+		Order("code ASC").
+		Select()
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, len(watchlist))
+	for _, coin := range watchlist {
+		codes = append(codes, coin.Code)
+	}
+
+	return codes, nil
+}
+
+func (s *Subscriber) watch(code string) (err error) {
+	_, err = dbConnect.Model(&WatchlistCoin{
+		SubscriberId: s.Id,
+		Code:         code,
+		CreatedAt:    time.Now(),
+	}).
+		OnConflict("(subscriber_id, code) DO NOTHING").
+		Insert()
+
+	return err
+}
+
+func (s *Subscriber) unwatch(code string) (err error) {
+	_, err = dbConnect.Model((*WatchlistCoin)(nil)).
+		Where("subscriber_id = ?", s.Id).
+		Where("code = ?", code).
+		Delete()
+
+	return err
+}
+
+func getSubscribersWatchlists(subscribers []Subscriber) (map[int64][]string, error) {
+	watchlists := make(map[int64][]string)
+
+	if len(subscribers) == 0 {
+		return watchlists, nil
+	}
+
+	ids := make([]int64, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		ids = append(ids, subscriber.Id)
+	}
+
+	var watchlist []WatchlistCoin
+	err := dbConnect.Model(&watchlist).
+		Where("subscriber_id IN (?)", pg.In(ids)).
+		Order("code ASC").
+		Select()
+
+	if err != nil {
+		return watchlists, err
+	}
+
+	for _, coin := range watchlist {
+		watchlists[coin.SubscriberId] = append(watchlists[coin.SubscriberId], coin.Code)
+	}
+
+	return watchlists, nil
+}
+
+func getWatchedCoins(repository MarketDataRepository, quote string, codes []string) (map[string]PercentCoinShort, error) {
+	watchedCoins := make(map[string]PercentCoinShort, len(codes))
+
+	if len(codes) == 0 {
+		return watchedCoins, nil
+	}
+
+	coins, err := repository.GetPercentCoins(quote, codes...)
+	if err != nil {
+		return watchedCoins, err
+	}
+
+	for _, coin := range coins {
+		watchedCoins[coin.Code] = coin
+	}
+
+	return watchedCoins, nil
+}
+
+func formatWatchlist(codes []string, watchedCoins map[string]PercentCoinShort, quote string) string {
+	var coins []PercentCoinShort
+
+	for _, code := range codes {
+		if coin, ok := watchedCoins[code]; ok && coin.Code != "" {
+			coins = append(coins, coin)
+		}
+	}
+
+	return formatPercentCoins(coins, "Watchlist, "+quote+".")
+}
+
+func parseCoinCodes(arguments string) []string {
+	var codes []string
+
+	for _, code := range strings.Fields(strings.ToUpper(arguments)) {
+		code = strings.Trim(code, ",?")
+		if code != "" && len(code) < 10 {
+			codes = append(codes, code)
+		}
+	}
+
+	return codes
+}
+
+func handleWatchCommand(subscriber *Subscriber, arguments string) string {
+	codes := parseCoinCodes(arguments)
+
+	if len(codes) == 0 {
+		return "Usage: /watch BTC ETH"
+	}
+
+	watchlist, err := subscriber.getWatchlist()
+	if err != nil {
+		log.Warnf("can't get subscriber watchlist: %v", err)
+		return "Возникла ошибка №435/5"
+	}
+
+	var result []string
+	quote := subscriber.getQuote()
+
+	for _, code := range codes {
+		exists, err := marketData.CoinExists(code, quote)
+		if err != nil {
+			log.Warnf("can't check coin %s: %v", code, err)
+			return "Возникла ошибка №435/5"
+		}
+
+		if !exists {
+			result = append(result, pairName(code, quote)+": pair not found")
+			continue
+		}
+
+		if containsString(watchlist, code) {
+			result = append(result, code+": already watching")
+			continue
+		}
+
+		if len(watchlist) >= watchlistLimit {
+			result = append(result, code+": watchlist is full")
+			continue
+		}
+
+		if err := subscriber.watch(code); err != nil {
+			log.Warnf("can't add coin to watchlist: %v", err)
+			return "Возникла ошибка №435/5"
+		}
+
+		watchlist = append(watchlist, code)
+		result = append(result, code+": watching")
+	}
+
+	return strings.Join(result, "\n")
+}
+
+func handleUnwatchCommand(subscriber *Subscriber, arguments string) string {
+	codes := parseCoinCodes(arguments)
+
+	if len(codes) == 0 {
+		return "Usage: /unwatch BTC ETH"
+	}
+
+	for _, code := range codes {
+		if err := subscriber.unwatch(code); err != nil {
+			log.Warnf("can't remove coin from watchlist: %v", err)
+			return "Возникла ошибка №435/5"
+		}
+	}
+
+	return "Removed: " + strings.Join(codes, ", ")
+}
+
+func handleWatchlistCommand(subscriber *Subscriber) string {
+	codes, err := subscriber.getWatchlist()
+	if err != nil {
+		log.Warnf("can't get subscriber watchlist: %v", err)
+		return "Возникла ошибка №435/5"
+	}
+
+	if len(codes) == 0 {
+		return "Watchlist is empty, add coins with /watch BTC ETH"
+	}
+
+	quote := subscriber.getQuote()
+
+	watchedCoins, err := getWatchedCoins(marketData, quote, codes)
+	if err != nil {
+		log.Errorf("can't get percent pairs: %v", err)
+		return "Watching: " + strings.Join(codes, ", ")
+	}
+
+	return "Watching: " + strings.Join(codes, ", ") + "\n" + formatWatchlist(codes, watchedCoins, quote)
+}